@@ -0,0 +1,617 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/ardielle/ardielle-go/rdl"
+)
+
+// schemaChange describes a single difference between two versions of a schema.
+type schemaChange struct {
+	Breaking bool   `json:"breaking"`
+	Kind     string `json:"kind"`
+	Context  string `json:"context"`
+	Message  string `json:"message"`
+}
+
+// diffReport is the result of comparing two schemas. It is written as-is in JSON mode.
+type diffReport struct {
+	Old      string          `json:"old"`
+	New      string          `json:"new"`
+	Breaking int             `json:"breaking"`
+	Changes  []*schemaChange `json:"changes"`
+}
+
+const (
+	changeAdded   = "added"
+	changeRemoved = "removed"
+	changeChanged = "changed"
+)
+
+type schemaDiffer struct {
+	changes []*schemaChange
+}
+
+func (d *schemaDiffer) report(breaking bool, kind string, context string, format string, args ...interface{}) {
+	d.changes = append(d.changes, &schemaChange{
+		Breaking: breaking,
+		Kind:     kind,
+		Context:  context,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// DiffSchemas compares oldSchema to newSchema and returns every difference found, each
+// marked as breaking (wire- or source-incompatible for existing clients) or not.
+func DiffSchemas(oldSchema *rdl.Schema, newSchema *rdl.Schema) []*schemaChange {
+	d := &schemaDiffer{changes: make([]*schemaChange, 0)}
+	d.diffSchemaInfo(oldSchema, newSchema)
+	d.diffTypes(oldSchema.Types, newSchema.Types)
+	d.diffResources(oldSchema.Resources, newSchema.Resources)
+	return d.changes
+}
+
+func (d *schemaDiffer) diffSchemaInfo(oldSchema *rdl.Schema, newSchema *rdl.Schema) {
+	if oldSchema.Name != newSchema.Name {
+		d.report(false, changeChanged, "schema", "name changed from %q to %q", oldSchema.Name, newSchema.Name)
+	}
+	if oldSchema.Namespace != newSchema.Namespace {
+		d.report(false, changeChanged, "schema", "namespace changed from %q to %q", oldSchema.Namespace, newSchema.Namespace)
+	}
+	if !reflect.DeepEqual(oldSchema.Version, newSchema.Version) {
+		d.report(false, changeChanged, "schema", "version changed from %s to %s", optionalInt32String(oldSchema.Version), optionalInt32String(newSchema.Version))
+	}
+	if oldSchema.Base != newSchema.Base {
+		d.report(true, changeChanged, "schema", "base path changed from %q to %q", oldSchema.Base, newSchema.Base)
+	}
+	if oldSchema.Comment != newSchema.Comment {
+		d.report(false, changeChanged, "schema", "comment changed")
+	}
+}
+
+func (d *schemaDiffer) diffTypes(oldTypes []*rdl.Type, newTypes []*rdl.Type) {
+	newByName := make(map[rdl.TypeName]*rdl.Type)
+	for _, t := range newTypes {
+		name, _, _ := rdl.TypeInfo(t)
+		newByName[name] = t
+	}
+	oldByName := make(map[rdl.TypeName]*rdl.Type)
+	for _, t := range oldTypes {
+		name, _, _ := rdl.TypeInfo(t)
+		oldByName[name] = t
+		context := "type " + string(name)
+		if nt, ok := newByName[name]; ok {
+			d.diffType(context, t, nt)
+		} else {
+			d.report(true, changeRemoved, context, "type removed")
+		}
+	}
+	for _, t := range newTypes {
+		name, _, _ := rdl.TypeInfo(t)
+		if _, ok := oldByName[name]; !ok {
+			d.report(false, changeAdded, "type "+string(name), "type added")
+		}
+	}
+}
+
+func (d *schemaDiffer) diffType(context string, oldType *rdl.Type, newType *rdl.Type) {
+	_, oldSuper, oldComment := rdl.TypeInfo(oldType)
+	_, newSuper, newComment := rdl.TypeInfo(newType)
+	if oldType.Variant != newType.Variant || oldSuper != newSuper {
+		d.report(true, changeChanged, context, "type definition changed from %s to %s", oldSuper, newSuper)
+		return
+	}
+	if oldComment != newComment {
+		d.report(false, changeChanged, context, "comment changed")
+	}
+	switch oldType.Variant {
+	case rdl.TypeVariantStructTypeDef:
+		d.diffStruct(context, oldType.StructTypeDef, newType.StructTypeDef)
+	case rdl.TypeVariantEnumTypeDef:
+		d.diffEnum(context, oldType.EnumTypeDef, newType.EnumTypeDef)
+	case rdl.TypeVariantStringTypeDef:
+		d.diffString(context, oldType.StringTypeDef, newType.StringTypeDef)
+	case rdl.TypeVariantNumberTypeDef:
+		d.diffNumber(context, oldType.NumberTypeDef, newType.NumberTypeDef)
+	case rdl.TypeVariantArrayTypeDef:
+		o, n := oldType.ArrayTypeDef, newType.ArrayTypeDef
+		if o.Items != n.Items {
+			d.report(true, changeChanged, context, "item type changed from %s to %s", o.Items, n.Items)
+		}
+		d.diffSize(context, o.Size, n.Size, o.MinSize, n.MinSize, o.MaxSize, n.MaxSize)
+	case rdl.TypeVariantMapTypeDef:
+		o, n := oldType.MapTypeDef, newType.MapTypeDef
+		if o.Keys != n.Keys {
+			d.report(true, changeChanged, context, "key type changed from %s to %s", o.Keys, n.Keys)
+		}
+		if o.Items != n.Items {
+			d.report(true, changeChanged, context, "item type changed from %s to %s", o.Items, n.Items)
+		}
+		d.diffSize(context, o.Size, n.Size, o.MinSize, n.MinSize, o.MaxSize, n.MaxSize)
+	case rdl.TypeVariantBytesTypeDef:
+		o, n := oldType.BytesTypeDef, newType.BytesTypeDef
+		d.diffSize(context, o.Size, n.Size, o.MinSize, n.MinSize, o.MaxSize, n.MaxSize)
+	case rdl.TypeVariantUnionTypeDef:
+		d.diffUnion(context, oldType.UnionTypeDef, newType.UnionTypeDef)
+	}
+}
+
+func (d *schemaDiffer) diffStruct(context string, oldDef *rdl.StructTypeDef, newDef *rdl.StructTypeDef) {
+	if !oldDef.Closed && newDef.Closed {
+		d.report(true, changeChanged, context, "struct is now closed")
+	} else if oldDef.Closed && !newDef.Closed {
+		d.report(false, changeChanged, context, "struct is no longer closed")
+	}
+	newFields := make(map[rdl.Identifier]*rdl.StructFieldDef)
+	for _, f := range newDef.Fields {
+		newFields[f.Name] = f
+	}
+	oldFields := make(map[rdl.Identifier]*rdl.StructFieldDef)
+	for _, of := range oldDef.Fields {
+		oldFields[of.Name] = of
+		fcontext := context + "." + string(of.Name)
+		nf, ok := newFields[of.Name]
+		if !ok {
+			d.report(true, changeRemoved, fcontext, "field removed")
+			continue
+		}
+		if of.Type != nf.Type || of.Items != nf.Items || of.Keys != nf.Keys {
+			d.report(true, changeChanged, fcontext, "field type changed from %s to %s", fieldTypeString(of), fieldTypeString(nf))
+		}
+		if of.Optional && !nf.Optional {
+			d.report(true, changeChanged, fcontext, "field was optional, is now required")
+		} else if !of.Optional && nf.Optional {
+			d.report(false, changeChanged, fcontext, "field was required, is now optional")
+		}
+		if !reflect.DeepEqual(of.Default, nf.Default) {
+			d.report(true, changeChanged, fcontext, "default changed from %v to %v", of.Default, nf.Default)
+		}
+		if of.Comment != nf.Comment {
+			d.report(false, changeChanged, fcontext, "comment changed")
+		}
+	}
+	for _, nf := range newDef.Fields {
+		if _, ok := oldFields[nf.Name]; !ok {
+			fcontext := context + "." + string(nf.Name)
+			if nf.Optional || nf.Default != nil {
+				d.report(false, changeAdded, fcontext, "optional field added")
+			} else {
+				d.report(true, changeAdded, fcontext, "required field added")
+			}
+		}
+	}
+}
+
+func fieldTypeString(f *rdl.StructFieldDef) string {
+	switch {
+	case f.Keys != "":
+		return fmt.Sprintf("%s<%s,%s>", f.Type, f.Keys, f.Items)
+	case f.Items != "":
+		return fmt.Sprintf("%s<%s>", f.Type, f.Items)
+	default:
+		return string(f.Type)
+	}
+}
+
+func (d *schemaDiffer) diffEnum(context string, oldDef *rdl.EnumTypeDef, newDef *rdl.EnumTypeDef) {
+	newSymbols := make(map[rdl.Identifier]bool)
+	for _, e := range newDef.Elements {
+		newSymbols[e.Symbol] = true
+	}
+	oldSymbols := make(map[rdl.Identifier]bool)
+	for _, e := range oldDef.Elements {
+		oldSymbols[e.Symbol] = true
+		if !newSymbols[e.Symbol] {
+			d.report(true, changeRemoved, context, "enum symbol %s removed", e.Symbol)
+		}
+	}
+	for _, e := range newDef.Elements {
+		if !oldSymbols[e.Symbol] {
+			d.report(false, changeAdded, context, "enum symbol %s added", e.Symbol)
+		}
+	}
+}
+
+func (d *schemaDiffer) diffString(context string, oldDef *rdl.StringTypeDef, newDef *rdl.StringTypeDef) {
+	if oldDef.Pattern != newDef.Pattern {
+		d.report(newDef.Pattern != "", changeChanged, context, "pattern changed from %q to %q", oldDef.Pattern, newDef.Pattern)
+	}
+	if len(oldDef.Values) > 0 && len(newDef.Values) == 0 {
+		d.report(false, changeRemoved, context, "value restriction removed")
+	} else if len(oldDef.Values) == 0 && len(newDef.Values) > 0 {
+		d.report(true, changeAdded, context, "value restriction added")
+	} else {
+		newValues := make(map[string]bool)
+		for _, v := range newDef.Values {
+			newValues[v] = true
+		}
+		oldValues := make(map[string]bool)
+		for _, v := range oldDef.Values {
+			oldValues[v] = true
+			if !newValues[v] {
+				d.report(true, changeRemoved, context, "allowed value %q removed", v)
+			}
+		}
+		for _, v := range newDef.Values {
+			if !oldValues[v] {
+				d.report(false, changeAdded, context, "allowed value %q added", v)
+			}
+		}
+	}
+	d.diffSize(context, nil, nil, oldDef.MinSize, newDef.MinSize, oldDef.MaxSize, newDef.MaxSize)
+}
+
+func (d *schemaDiffer) diffNumber(context string, oldDef *rdl.NumberTypeDef, newDef *rdl.NumberTypeDef) {
+	oldMin, hasOldMin := numberValue(oldDef.Min)
+	newMin, hasNewMin := numberValue(newDef.Min)
+	if hasOldMin != hasNewMin || oldMin != newMin {
+		tighter := hasNewMin && (!hasOldMin || newMin > oldMin)
+		d.report(tighter, changeChanged, context, "min changed from %s to %s", numberString(oldDef.Min), numberString(newDef.Min))
+	}
+	oldMax, hasOldMax := numberValue(oldDef.Max)
+	newMax, hasNewMax := numberValue(newDef.Max)
+	if hasOldMax != hasNewMax || oldMax != newMax {
+		tighter := hasNewMax && (!hasOldMax || newMax < oldMax)
+		d.report(tighter, changeChanged, context, "max changed from %s to %s", numberString(oldDef.Max), numberString(newDef.Max))
+	}
+}
+
+func numberValue(n *rdl.Number) (float64, bool) {
+	if n == nil {
+		return 0, false
+	}
+	switch {
+	case n.Int8 != nil:
+		return float64(*n.Int8), true
+	case n.Int16 != nil:
+		return float64(*n.Int16), true
+	case n.Int32 != nil:
+		return float64(*n.Int32), true
+	case n.Int64 != nil:
+		return float64(*n.Int64), true
+	case n.Float32 != nil:
+		return float64(*n.Float32), true
+	case n.Float64 != nil:
+		return *n.Float64, true
+	}
+	return 0, false
+}
+
+func numberString(n *rdl.Number) string {
+	if v, ok := numberValue(n); ok {
+		return fmt.Sprintf("%g", v)
+	}
+	return "none"
+}
+
+func optionalInt32String(n *int32) string {
+	if n == nil {
+		return "none"
+	}
+	return fmt.Sprintf("%d", *n)
+}
+
+func (d *schemaDiffer) diffSize(context string, oldSize, newSize, oldMin, newMin, oldMax, newMax *int32) {
+	if !reflect.DeepEqual(oldSize, newSize) {
+		d.report(newSize != nil, changeChanged, context, "size changed from %s to %s", optionalInt32String(oldSize), optionalInt32String(newSize))
+	}
+	if !reflect.DeepEqual(oldMin, newMin) {
+		tighter := newMin != nil && (oldMin == nil || *newMin > *oldMin)
+		d.report(tighter, changeChanged, context, "minSize changed from %s to %s", optionalInt32String(oldMin), optionalInt32String(newMin))
+	}
+	if !reflect.DeepEqual(oldMax, newMax) {
+		tighter := newMax != nil && (oldMax == nil || *newMax < *oldMax)
+		d.report(tighter, changeChanged, context, "maxSize changed from %s to %s", optionalInt32String(oldMax), optionalInt32String(newMax))
+	}
+}
+
+func (d *schemaDiffer) diffUnion(context string, oldDef *rdl.UnionTypeDef, newDef *rdl.UnionTypeDef) {
+	newVariants := make(map[rdl.TypeRef]bool)
+	for _, v := range newDef.Variants {
+		newVariants[v] = true
+	}
+	oldVariants := make(map[rdl.TypeRef]bool)
+	for _, v := range oldDef.Variants {
+		oldVariants[v] = true
+		if !newVariants[v] {
+			d.report(true, changeRemoved, context, "union variant %s removed", v)
+		}
+	}
+	for _, v := range newDef.Variants {
+		if !oldVariants[v] {
+			//clients that switch on the variant will not know about the new one
+			d.report(true, changeAdded, context, "union variant %s added", v)
+		}
+	}
+}
+
+// resourceKey identifies a resource independently of its path parameter names, so that
+// renaming a path parameter is reported as a change rather than a remove and an add.
+func resourceKey(r *rdl.Resource) string {
+	path := r.Path
+	i := strings.Index(path, "{")
+	for i >= 0 {
+		j := strings.Index(path[i:], "}")
+		if j < 0 {
+			break
+		}
+		path = path[:i] + "*" + path[i+j+1:]
+		i = strings.Index(path, "{")
+	}
+	return strings.ToUpper(r.Method) + " " + path
+}
+
+func resourceContext(r *rdl.Resource) string {
+	return "resource " + strings.ToUpper(r.Method) + " " + r.Path
+}
+
+func (d *schemaDiffer) diffResources(oldResources []*rdl.Resource, newResources []*rdl.Resource) {
+	newByKey := make(map[string]*rdl.Resource)
+	for _, r := range newResources {
+		newByKey[resourceKey(r)] = r
+	}
+	oldByKey := make(map[string]*rdl.Resource)
+	for _, r := range oldResources {
+		key := resourceKey(r)
+		oldByKey[key] = r
+		if nr, ok := newByKey[key]; ok {
+			d.diffResource(resourceContext(nr), r, nr)
+		} else {
+			d.report(true, changeRemoved, resourceContext(r), "resource removed")
+		}
+	}
+	for _, r := range newResources {
+		if _, ok := oldByKey[resourceKey(r)]; !ok {
+			d.report(false, changeAdded, resourceContext(r), "resource added")
+		}
+	}
+}
+
+func (d *schemaDiffer) diffResource(context string, o *rdl.Resource, n *rdl.Resource) {
+	if o.Name != n.Name {
+		d.report(true, changeChanged, context, "name changed from %q to %q", o.Name, n.Name)
+	}
+	if o.Type != n.Type {
+		d.report(true, changeChanged, context, "type changed from %s to %s", o.Type, n.Type)
+	}
+	if o.Comment != n.Comment {
+		d.report(false, changeChanged, context, "comment changed")
+	}
+	if o.Expected != n.Expected {
+		d.report(true, changeChanged, context, "expected status changed from %s to %s", o.Expected, n.Expected)
+	}
+	for _, s := range o.Alternatives {
+		if !containsString(n.Alternatives, s) {
+			d.report(true, changeRemoved, context, "alternative status %s removed", s)
+		}
+	}
+	for _, s := range n.Alternatives {
+		if !containsString(o.Alternatives, s) {
+			d.report(true, changeAdded, context, "alternative status %s added", s)
+		}
+	}
+	d.diffAuth(context, o.Auth, n.Auth)
+	d.diffInputs(context, o, n)
+	d.diffOutputs(context, o.Outputs, n.Outputs)
+	d.diffExceptions(context, o.Exceptions, n.Exceptions)
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func authString(a *rdl.ResourceAuth) string {
+	if a == nil {
+		return "none"
+	}
+	if a.Authenticate {
+		return "authenticate"
+	}
+	s := fmt.Sprintf("authorize(%q, %q", a.Action, a.Resource)
+	if a.Domain != "" {
+		s += fmt.Sprintf(", %q", a.Domain)
+	}
+	return s + ")"
+}
+
+func (d *schemaDiffer) diffAuth(context string, o *rdl.ResourceAuth, n *rdl.ResourceAuth) {
+	if reflect.DeepEqual(o, n) {
+		return
+	}
+	//relaxing access control does not break callers, anything else might
+	d.report(n != nil, changeChanged, context, "auth changed from %s to %s", authString(o), authString(n))
+}
+
+func inputKind(in *rdl.ResourceInput) string {
+	switch {
+	case in.PathParam:
+		return "path param"
+	case in.QueryParam != "":
+		return "query param"
+	case in.Header != "":
+		return "header param"
+	default:
+		return "body"
+	}
+}
+
+func (d *schemaDiffer) diffInputs(context string, o *rdl.Resource, n *rdl.Resource) {
+	//path params are matched by position, since the resource key ignores their names
+	var oldPath, newPath []*rdl.ResourceInput
+	oldByName := make(map[rdl.Identifier]*rdl.ResourceInput)
+	newByName := make(map[rdl.Identifier]*rdl.ResourceInput)
+	for _, in := range o.Inputs {
+		if in.PathParam {
+			oldPath = append(oldPath, in)
+		} else {
+			oldByName[in.Name] = in
+		}
+	}
+	for _, in := range n.Inputs {
+		if in.PathParam {
+			newPath = append(newPath, in)
+		} else {
+			newByName[in.Name] = in
+		}
+	}
+	for i, oin := range oldPath {
+		if i >= len(newPath) {
+			break
+		}
+		nin := newPath[i]
+		icontext := context + " input " + string(nin.Name)
+		if oin.Name != nin.Name {
+			d.report(true, changeChanged, icontext, "path param renamed from %s to %s", oin.Name, nin.Name)
+		}
+		d.diffInput(icontext, oin, nin)
+	}
+	for _, oin := range o.Inputs {
+		if oin.PathParam {
+			continue
+		}
+		icontext := context + " input " + string(oin.Name)
+		nin, ok := newByName[oin.Name]
+		if !ok {
+			d.report(true, changeRemoved, icontext, "%s removed", inputKind(oin))
+			continue
+		}
+		d.diffInput(icontext, oin, nin)
+	}
+	for _, nin := range n.Inputs {
+		if nin.PathParam {
+			continue
+		}
+		if _, ok := oldByName[nin.Name]; !ok {
+			icontext := context + " input " + string(nin.Name)
+			if nin.Optional || nin.Default != nil {
+				d.report(false, changeAdded, icontext, "optional %s added", inputKind(nin))
+			} else {
+				d.report(true, changeAdded, icontext, "required %s added", inputKind(nin))
+			}
+		}
+	}
+}
+
+func (d *schemaDiffer) diffInput(context string, o *rdl.ResourceInput, n *rdl.ResourceInput) {
+	if inputKind(o) != inputKind(n) {
+		d.report(true, changeChanged, context, "input changed from %s to %s", inputKind(o), inputKind(n))
+	}
+	if o.Type != n.Type {
+		d.report(true, changeChanged, context, "type changed from %s to %s", o.Type, n.Type)
+	}
+	if o.QueryParam != n.QueryParam && o.QueryParam != "" && n.QueryParam != "" {
+		d.report(true, changeChanged, context, "query param name changed from %q to %q", o.QueryParam, n.QueryParam)
+	}
+	if !strings.EqualFold(o.Header, n.Header) && o.Header != "" && n.Header != "" {
+		d.report(true, changeChanged, context, "header changed from %q to %q", o.Header, n.Header)
+	}
+	if o.Pattern != n.Pattern {
+		d.report(true, changeChanged, context, "path pattern changed from %q to %q", o.Pattern, n.Pattern)
+	}
+	oldOptional := o.Optional || o.Default != nil
+	newOptional := n.Optional || n.Default != nil
+	if oldOptional && !newOptional {
+		d.report(true, changeChanged, context, "input was optional, is now required")
+	} else if !oldOptional && newOptional {
+		d.report(false, changeChanged, context, "input was required, is now optional")
+	}
+	if !reflect.DeepEqual(o.Default, n.Default) {
+		d.report(true, changeChanged, context, "default changed from %v to %v", o.Default, n.Default)
+	}
+	if o.Comment != n.Comment {
+		d.report(false, changeChanged, context, "comment changed")
+	}
+}
+
+func (d *schemaDiffer) diffOutputs(context string, oldOutputs []*rdl.ResourceOutput, newOutputs []*rdl.ResourceOutput) {
+	newByName := make(map[rdl.Identifier]*rdl.ResourceOutput)
+	for _, out := range newOutputs {
+		newByName[out.Name] = out
+	}
+	oldByName := make(map[rdl.Identifier]*rdl.ResourceOutput)
+	for _, oout := range oldOutputs {
+		oldByName[oout.Name] = oout
+		ocontext := context + " output " + string(oout.Name)
+		nout, ok := newByName[oout.Name]
+		if !ok {
+			d.report(true, changeRemoved, ocontext, "output header removed")
+			continue
+		}
+		if oout.Type != nout.Type {
+			d.report(true, changeChanged, ocontext, "type changed from %s to %s", oout.Type, nout.Type)
+		}
+		if !strings.EqualFold(oout.Header, nout.Header) {
+			d.report(true, changeChanged, ocontext, "header changed from %q to %q", oout.Header, nout.Header)
+		}
+		if !oout.Optional && nout.Optional {
+			d.report(true, changeChanged, ocontext, "output was required, is now optional")
+		} else if oout.Optional && !nout.Optional {
+			d.report(false, changeChanged, ocontext, "output was optional, is now required")
+		}
+		if oout.Comment != nout.Comment {
+			d.report(false, changeChanged, ocontext, "comment changed")
+		}
+	}
+	for _, nout := range newOutputs {
+		if _, ok := oldByName[nout.Name]; !ok {
+			d.report(false, changeAdded, context+" output "+string(nout.Name), "output header added")
+		}
+	}
+}
+
+func (d *schemaDiffer) diffExceptions(context string, oldExceptions map[string]*rdl.ExceptionDef, newExceptions map[string]*rdl.ExceptionDef) {
+	for _, code := range sortedExceptionCodes(oldExceptions) {
+		oe := oldExceptions[code]
+		ne, ok := newExceptions[code]
+		if !ok {
+			d.report(false, changeRemoved, context, "exception %s removed", code)
+		} else if oe.Type != ne.Type {
+			d.report(true, changeChanged, context, "exception %s type changed from %s to %s", code, oe.Type, ne.Type)
+		}
+	}
+	for _, code := range sortedExceptionCodes(newExceptions) {
+		if _, ok := oldExceptions[code]; !ok {
+			d.report(false, changeAdded, context, "exception %s added", code)
+		}
+	}
+}
+
+// sortedExceptionCodes returns the codes of the exceptions of a resource in order.
+func sortedExceptionCodes(m map[string]*rdl.ExceptionDef) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func writeDiffReport(out io.Writer, report *diffReport, asJSON bool) error {
+	if asJSON {
+		j, err := json.MarshalIndent(report, "", "    ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(out, string(j))
+		return err
+	}
+	for _, c := range report.Changes {
+		tag := "non-breaking"
+		if c.Breaking {
+			tag = "BREAKING"
+		}
+		fmt.Fprintf(out, "%-12s %-8s %s: %s\n", tag, c.Kind, c.Context, c.Message)
+	}
+	fmt.Fprintf(out, "%d change(s), %d breaking\n", len(report.Changes), report.Breaking)
+	return nil
+}
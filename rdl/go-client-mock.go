@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// goClientAPI returns the code of the interface that the client of the given name implements, and
+// of a mock implementation of it for tests, given the signatures of the client methods.
+func goClientAPI(name string, sigs []string) (string, error) {
+	api := name + "API"
+	mock := api + "Mock"
+	var iface, fields, methods []string
+	for _, sig := range sigs {
+		m, err := parseMethodType(sig)
+		if err != nil {
+			return "", err
+		}
+		meth := m.decl.Name.Name
+		fn := sig[len(meth):]
+		var args []string
+		for _, f := range m.decl.Type.Params.List {
+			for _, n := range f.Names {
+				args = append(args, n.Name)
+			}
+		}
+		iface = append(iface, "\t"+sig)
+		fields = append(fields, "\t"+meth+"Func func"+fn)
+		s := "func (mock *" + mock + ") " + sig + " {\n"
+		s += "\tmock.record(" + strings.Join(append([]string{fmt.Sprintf("%q", meth)}, args...), ", ") + ")\n"
+		s += "\tif mock." + meth + "Func == nil {\n"
+		s += fmt.Sprintf("\t\tpanic(%q)\n", mock+"."+meth+"Func is not set")
+		s += "\t}\n"
+		s += "\treturn mock." + meth + "Func(" + strings.Join(args, ", ") + ")\n"
+		s += "}\n"
+		methods = append(methods, s)
+	}
+
+	s := "// " + api + " is the interface of " + name + "Client, to be substituted with " + mock + " in tests.\n"
+	s += "type " + api + " interface {\n" + strings.Join(iface, "\n") + "\n}\n\n"
+	s += "var _ " + api + " = " + name + "Client{}\n"
+	s += "var _ " + api + " = (*" + mock + ")(nil)\n\n"
+	s += "// " + mock + " implements " + api + " by calling the function set for each method, and records\n"
+	s += "// the calls. It panics when a method is called whose function is not set.\n"
+	s += "type " + mock + " struct {\n" + strings.Join(fields, "\n") + "\n\n"
+	s += "\tmu    sync.Mutex\n"
+	s += "\tcalls []" + api + "Call\n"
+	s += "}\n\n"
+	s += "// " + api + "Call is a call recorded by " + mock + ".\n"
+	s += "type " + api + "Call struct {\n"
+	s += "\tMethod string\n"
+	s += "\tArgs   []interface{}\n"
+	s += "}\n\n"
+	s += "func (mock *" + mock + ") record(method string, args ...interface{}) {\n"
+	s += "\tmock.mu.Lock()\n"
+	s += "\tdefer mock.mu.Unlock()\n"
+	s += "\tmock.calls = append(mock.calls, " + api + "Call{Method: method, Args: args})\n"
+	s += "}\n\n"
+	s += "// Calls returns the calls made so far, in order. If methods are given, only the calls to them are returned.\n"
+	s += "func (mock *" + mock + ") Calls(methods ...string) []" + api + "Call {\n"
+	s += "\tmock.mu.Lock()\n"
+	s += "\tdefer mock.mu.Unlock()\n"
+	s += "\tvar calls []" + api + "Call\n"
+	s += "\tfor _, call := range mock.calls {\n"
+	s += "\t\tif len(methods) == 0 {\n"
+	s += "\t\t\tcalls = append(calls, call)\n"
+	s += "\t\t\tcontinue\n"
+	s += "\t\t}\n"
+	s += "\t\tfor _, m := range methods {\n"
+	s += "\t\t\tif m == call.Method {\n"
+	s += "\t\t\t\tcalls = append(calls, call)\n"
+	s += "\t\t\t}\n"
+	s += "\t\t}\n"
+	s += "\t}\n"
+	s += "\treturn calls\n"
+	s += "}\n"
+	for _, m := range methods {
+		s += "\n" + m
+	}
+	return s, nil
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/ardielle/ardielle-go/gen/gomodel"
+	"github.com/ardielle/ardielle-go/rdl"
+)
+
+// goPagination describes how the pages of a resource are followed, as declared by its x_paginate
+// annotation: either "<input>=<field>", where the query param <input> is set to the continuation
+// token in the <field> of each page until it is empty, or "<input>", where the integer query param
+// <input> is the offset of the page, advanced by the number of its items until a page is empty.
+type goPagination struct {
+	input     *rdl.ResourceInput
+	inputType string
+	token     string
+	tokenType string
+	list      string
+	itemType  string
+}
+
+// paginationOf returns the pagination of the resource, or nil if it is not annotated with
+// x_paginate, or an error if the annotation is not valid.
+func paginationOf(reg rdl.TypeRegistry, r *rdl.Resource, precise bool) (*goPagination, error) {
+	spec, ok := r.Annotations["x_paginate"]
+	if !ok {
+		return nil, nil
+	}
+	bad := func(msg string) (*goPagination, error) {
+		return nil, fmt.Errorf("x_paginate %q of resource %s %s: %s", spec, strings.ToUpper(r.Method), r.Path, msg)
+	}
+	p := &goPagination{}
+	name := string(spec)
+	if i := strings.Index(name, "="); i >= 0 {
+		name, p.token = name[:i], name[i+1:]
+	}
+	for _, in := range r.Inputs {
+		if string(in.Name) == name && in.QueryParam != "" {
+			p.input = in
+		}
+	}
+	if p.input == nil {
+		return bad("there is no query param " + name)
+	}
+	p.inputType = gomodel.GoType2(reg, p.input.Type, p.input.Optional, "", "", precise, true, "")
+	inputBase := reg.BaseTypeName(p.input.Type)
+	if r.Expected == "NO_CONTENT" && r.Alternatives == nil {
+		return bad("the resource has no content")
+	}
+	list, ok := memoryListField(reg, r.Type)
+	if !ok {
+		return bad("the result " + string(r.Type) + " has no array of items")
+	}
+	p.list = list
+	items := arrayItems(reg, r.Type)
+	if list != "" {
+		for _, f := range flattenedFields(reg, reg.FindType(r.Type)) {
+			if string(f.Name) == list {
+				items = f.Items
+				if items == "" {
+					items = arrayItems(reg, f.Type)
+				}
+			}
+		}
+	}
+	if items == "" {
+		return bad("the items of the result " + string(r.Type) + " have no type")
+	}
+	p.itemType = gomodel.GoType(reg, items, false, "", "", precise, true)
+	if p.token == "" {
+		switch inputBase {
+		case "Int8", "Int16", "Int32", "Int64":
+		default:
+			return bad("the offset " + name + " is not an integer")
+		}
+		return p, nil
+	}
+	if inputBase != "String" || strings.HasPrefix(p.inputType, "*") {
+		return bad("the continuation token " + name + " is not a string")
+	}
+	found := false
+	if t := reg.FindType(r.Type); t != nil && reg.BaseType(t) == rdl.BaseTypeStruct {
+		for _, f := range flattenedFields(reg, t) {
+			if string(f.Name) == p.token && reg.BaseTypeName(f.Type) == "String" {
+				p.tokenType = gomodel.GoType(reg, f.Type, false, "", "", precise, true)
+				found = true
+			}
+		}
+	}
+	if !found {
+		return bad("the result " + string(r.Type) + " has no string field " + p.token)
+	}
+	return p, nil
+}
+
+// goClientPaginatorSignature returns the signature of the client method that creates the iterator
+// over the items of all the pages of the resource, or "" if the resource is not paginated.
+func goClientPaginatorSignature(reg rdl.TypeRegistry, r *rdl.Resource, precise bool, reqRep bool) string {
+	p, _ := paginationOf(reg, r, precise)
+	if p == nil {
+		return ""
+	}
+	methName, params := goMethodName(reg, r, precise)
+	meth := capitalize(methName)
+	if reqRep {
+		return meth + "All(ctx context.Context, req *" + meth + "Request) *" + meth + "Iterator"
+	}
+	sparams := []string{"ctx context.Context"}
+	i := 0
+	for _, in := range r.Inputs {
+		if in.Context != "" { //legacy field, to be removed
+			continue
+		}
+		i++
+		if in != p.input {
+			sparams = append(sparams, params[i-1])
+		}
+	}
+	return meth + "All(" + strings.Join(sparams, ", ") + ") *" + meth + "Iterator"
+}
+
+// goClientPaginator returns the iterator over the items of all the pages of the resource, and the
+// client method that creates it, or "" if the resource is not paginated.
+func goClientPaginator(reg rdl.TypeRegistry, r *rdl.Resource, precise bool, client string, reqRep bool) string {
+	p, err := paginationOf(reg, r, precise)
+	if err != nil {
+		log.Printf("RDL error: %v\n", err)
+	}
+	if p == nil {
+		return ""
+	}
+	methName, _ := goMethodName(reg, r, precise)
+	meth := capitalize(methName)
+	iter := meth + "Iterator"
+	items := "[]" + p.itemType
+	name := goName(string(p.input.Name))
+	vtype := strings.TrimPrefix(p.inputType, "*")
+	sig := goClientPaginatorSignature(reg, r, precise, reqRep)
+
+	s := "\n// " + iter + " iterates over the items of all the pages of " + meth + ".\n"
+	s += "type " + iter + " struct {\n"
+	s += "\tctx   context.Context\n"
+	s += "\tpage  func() (" + items + ", bool, error)\n"
+	s += "\titems " + items + "\n"
+	s += "\titem  " + p.itemType + "\n"
+	s += "\tmore  bool\n"
+	s += "\terr   error\n"
+	s += "}\n\n"
+	s += "// Next advances to the next item, and fetches the next page when needed. It returns false when\n"
+	s += "// the pages are exhausted, the context is done, or a request failed, as reported by Err.\n"
+	s += "func (it *" + iter + ") Next() bool {\n"
+	s += "\tfor len(it.items) == 0 {\n"
+	s += "\t\tif !it.more || it.err != nil {\n"
+	s += "\t\t\treturn false\n"
+	s += "\t\t}\n"
+	s += "\t\tif it.err = it.ctx.Err(); it.err != nil {\n"
+	s += "\t\t\treturn false\n"
+	s += "\t\t}\n"
+	s += "\t\tit.items, it.more, it.err = it.page()\n"
+	s += "\t}\n"
+	s += "\tit.item, it.items = it.items[0], it.items[1:]\n"
+	s += "\treturn true\n"
+	s += "}\n\n"
+	s += "// Item returns the current item.\n"
+	s += "func (it *" + iter + ") Item() " + p.itemType + " {\n"
+	s += "\treturn it.item\n"
+	s += "}\n\n"
+	s += "// Err returns the error that stopped the iteration, if any.\n"
+	s += "func (it *" + iter + ") Err() error {\n"
+	s += "\treturn it.err\n"
+	s += "}\n\n"
+	s += "// New" + iter + " returns an iterator over the items, which then stops with err if it is not\n"
+	s += "// nil, i.e. for the " + meth + "AllFunc of a mock client.\n"
+	s += "func New" + iter + "(items " + items + ", err error) *" + iter + " {\n"
+	s += "\treturn &" + iter + "{ctx: context.Background(), items: items, err: err}\n"
+	s += "}\n\n"
+
+	follows := "following the continuation token"
+	if p.token == "" {
+		follows = "advancing the offset"
+	}
+	s += "// " + meth + "All returns an iterator over the items of all the pages of " + meth + ",\n"
+	s += "// " + follows + " until the pages are exhausted, or the context is done.\n"
+	list := "data"
+	if p.list != "" {
+		list = "data." + capitalize(p.list)
+	}
+	var call, arg string
+	if reqRep {
+		field := "next." + capitalize(name)
+		s += "func (client " + client + ") " + sig + " {\n"
+		s += "\tnext := *req\n"
+		if p.token == "" {
+			if strings.HasPrefix(p.inputType, "*") {
+				s += "\tvar " + name + " " + vtype + "\n"
+				s += "\tif " + field + " != nil {\n"
+				s += "\t\t" + name + " = *" + field + "\n"
+				s += "\t}\n"
+				arg = "\t\t" + field + " = &" + name + "\n"
+			} else {
+				s += "\t" + name + " := " + field + "\n"
+				arg = "\t\t" + field + " = " + name + "\n"
+			}
+		}
+		call = "\t\tresp, err := client." + meth + "(ctx, &next)\n"
+		call += "\t\tif err != nil {\n\t\t\treturn nil, false, err\n\t\t}\n"
+		call += "\t\tdata := resp.Body\n"
+		name = field
+	} else {
+		var args []string
+		for _, in := range r.Inputs {
+			if in.Context != "" { //legacy field, to be removed
+				continue
+			}
+			if in == p.input {
+				if strings.HasPrefix(p.inputType, "*") {
+					args = append(args, "&"+name)
+				} else {
+					args = append(args, name)
+				}
+				continue
+			}
+			args = append(args, goName(string(in.Name)))
+		}
+		s += "func (client " + client + ") " + sig + " {\n"
+		s += "\tclient.ctx = ctx //the requests of this copy of the client are bound to ctx\n"
+		s += "\tvar " + name + " " + vtype + "\n"
+		results := "data"
+		for range r.Outputs {
+			results += ", _"
+		}
+		call = "\t\t" + results + ", err := client." + meth + "(" + strings.Join(args, ", ") + ")\n"
+		call += "\t\tif err != nil {\n\t\t\treturn nil, false, err\n\t\t}\n"
+	}
+	s += "\tpage := func() (" + items + ", bool, error) {\n"
+	s += arg + call
+	if p.token == "" {
+		local := name
+		if reqRep {
+			local = goName(string(p.input.Name))
+		}
+		s += "\t\t" + local + " += " + vtype + "(len(" + list + "))\n"
+		s += "\t\treturn " + list + ", len(" + list + ") > 0, nil\n"
+	} else {
+		token := "data." + capitalize(p.token)
+		if p.tokenType != vtype {
+			token = vtype + "(" + token + ")"
+		}
+		s += "\t\t" + name + " = " + token + "\n"
+		s += "\t\treturn " + list + ", " + name + " != \"\", nil\n"
+	}
+	s += "\t}\n"
+	s += "\treturn &" + iter + "{ctx: ctx, page: page, more: true}\n"
+	s += "}\n"
+	return s
+}
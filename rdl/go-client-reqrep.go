@@ -36,10 +36,13 @@ import (
 	rdl "{{rdlruntime}}"
 	"io"
 	"io/ioutil"
+	"math/rand"
 	"net/http"
 	"net/url"
+	"reflect"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 	"context"
 )
@@ -55,11 +58,14 @@ type {{client}} struct {
 	CredsHeader *string
 	CredsToken  *string
 	Timeout     time.Duration
+	Retry         {{client}}RetryPolicy
+	RequestHooks  []{{client}}RequestHook
+	ResponseHooks []{{client}}ResponseHook
 }
 
 // NewClient creates and returns a new HTTP client object for the {{.Name}} service
 func NewClient(url string, transport http.RoundTripper) {{client}} {
-	return {{client}}{url, transport, nil, nil, 0}
+	return {{client}}{URL: url, Transport: transport}
 }
 
 // AddCredentials adds the credentials to the client for subsequent requests.
@@ -92,8 +98,10 @@ func (client {{client}}) addAuthHeader(req *http.Request) {
 }
 
 func (cl {{client}}) httpDo(ctx context.Context, req *http.Request) (*http.Response, error) {
-   client := cl.getClient()
-	resp, err := client.Do(req.WithContext(ctx))
+	hclient := cl.getClient()
+	resp, err := cl.Retry.do(func(req *http.Request) (*http.Response, error) {
+		return cl.send(hclient, req)
+	}, req.WithContext(ctx))
 	if err != nil {
 	   // get context error if there is one
 		select {
@@ -212,6 +220,7 @@ func (client {{client}}) httpOptions(ctx context.Context, url string, headers ma
    return client.httpDo(ctx, req)
 }
 
+{{template "hooks" .}}{{template "retry" .}}{{template "exception" .}}
 func appendHeader(headers map[string]string, name, val string) map[string]string {
    if val == "" {
       return headers
@@ -273,7 +282,10 @@ func encodeFloat64Param(name string, i float64, def float64) string {
 }
 func encodeOptionalEnumParam(name string, e interface{}) string {
 	if e == nil {
-		return "\"\""
+		return ""
+	}
+	if v := reflect.ValueOf(e); v.Kind() == reflect.Ptr && v.IsNil() {
+		return ""
 	}
 	return fmt.Sprintf("&%s=%v", name, e)
 }
@@ -295,8 +307,27 @@ func encodeOptionalInt64Param(name string, i *int64) string {
 	}
 	return "&" + name + "=" + strconv.Itoa(int(*i))
 }
+// encodeListParam encodes the items of the list as the query param in the style declared by its
+// x_list_style annotation: "csv" (a=1,2), "brackets" (a[]=1&a[]=2), or else the repeated key (a=1&a=2).
+func encodeListParam(name string, list interface{}, style string) string {
+	v := reflect.ValueOf(list)
+	if v.Kind() != reflect.Slice || v.Len() == 0 {
+		return ""
+	}
+	items := make([]string, v.Len())
+	for i := range items {
+		items[i] = url.QueryEscape(fmt.Sprint(v.Index(i).Interface()))
+	}
+	switch style {
+	case "csv":
+		return "&" + name + "=" + strings.Join(items, ",")
+	case "brackets":
+		name += "[]"
+	}
+	return "&" + name + "=" + strings.Join(items, "&"+name+"=")
+}
 func encodeParams(objs ...string) string {
-	s := strings.Join(objs, "&")
+	s := strings.Join(objs, "")
 	if s == "" {
 		return s
 	}
@@ -304,7 +335,7 @@ func encodeParams(objs ...string) string {
 }
 {{range methods}}
 type {{.RequestName}} struct {
-{{range .Inputs}}   {{.Name}} {{.TypeName}}
+{{range .Inputs}}   {{.Name}} {{.TypeName}}{{if .HeaderOmittedIfEmpty}} // the {{.Header}} header is not sent if empty{{end}}
 {{end}}
 }
 
@@ -316,8 +347,12 @@ type {{.ResponseName}} struct {
 func (client {{client}}) {{.Signature}} {
 	var response {{.ResponseName}}
 	var headers map[string]string
-	{{range .Inputs}}{{if (ne .Header  "")}}
-	    headers = appendHeader(headers, "{{.Header}}", req.{{.Name}})
+	{{range .Inputs}}{{if .HeaderCondition}}
+	    if {{.HeaderCondition}} {
+	        headers = appendHeader(headers, "{{.Header}}", {{.HeaderExpression}})
+	    }
+   {{else if (ne .Header  "")}}
+	    headers = appendHeader(headers, "{{.Header}}", {{.HeaderExpression}})
    {{end}}{{end}}
    url := client.URL + {{.URLExpression}}
    {{.Invocation}}
@@ -327,9 +362,14 @@ func (client {{client}}) {{.Signature}} {
    defer resp.Body.Close()
    switch resp.StatusCode {
    {{.ResponseCases}}
+   {{exceptionCases .}}
    default:
       var errobj rdl.ResourceError
-	  err = json.NewDecoder(resp.Body).Decode(&errobj)
+	  outputBytes, err := ioutil.ReadAll(resp.Body)
+	  if err != nil {
+		  return nil, err
+	  }
+	  err = json.Unmarshal(outputBytes, &errobj)
 	  if err != nil {
 		  return nil, err
 	  }
@@ -345,7 +385,8 @@ func (client {{client}}) {{.Signature}} {
    return &response, nil
 	//end loop
 }
-{{end}}`
+{{paginate .Resource}}{{end}}
+{{api}}`
 
 func (gen *reqRepClientGenerator) emitClient() error {
 	commentFun := func(s string) string {
@@ -375,8 +416,29 @@ func (gen *reqRepClientGenerator) emitClient() error {
 		"comment":    commentFun,
 		"methods":    methodFunc,
 		"client":     func() string { return gen.name + "Client" },
+		"paginate": func(r *rdl.Resource) string {
+			return goClientPaginator(gen.registry, r, gen.precise, gen.name+"Client", true)
+		},
+		"exceptionCases": func(m *reqRepMethod) string {
+			return goClientExceptionCases(gen.registry, m.Resource, gen.precise, gen.name+"Client", ":=", func(e string) string {
+				return "return nil, " + e
+			})
+		},
+		"api": func() (string, error) {
+			var sigs []string
+			for _, m := range methodFunc() {
+				sigs = append(sigs, m.Signature())
+				if sig := goClientPaginatorSignature(gen.registry, m.Resource, gen.precise, true); sig != "" {
+					sigs = append(sigs, sig)
+				}
+			}
+			return goClientAPI(gen.name, sigs)
+		},
 	}
 	t := template.Must(template.New("REQREP_CLIENT_TEMPLATE").Funcs(funcMap).Parse(rrClientTemplate))
+	template.Must(t.New("hooks").Parse(clientHooksTemplate))
+	template.Must(t.New("retry").Parse(clientRetryTemplate))
+	template.Must(t.New("exception").Parse(clientExceptionTemplate))
 	var output bytes.Buffer
 	if err := t.Execute(gen.writer, gen.schema); err != nil {
 		return err
@@ -397,6 +459,9 @@ type reqRepVar struct {
 	QueryParameter            string
 	PathParameter             bool
 	Header                    string
+	HeaderExpression          string
+	HeaderCondition           string
+	HeaderOmittedIfEmpty      bool
 	Comment                   string
 }
 
@@ -529,9 +594,9 @@ func (m *reqRepMethod) ParseOutputHeaders() (string, error) {
 	for _, out := range m.Outputs {
 		if out.Header != "" {
 			if out.TypeName != "string" {
-				code.Printf("response.%s = %s(resp.Header.Get(rdl.FoldHttpHeaderName(%q))", out.Name, out.TypeName, out.Header)
+				code.Printf("response.%s = %s(resp.Header.Get(rdl.FoldHttpHeaderName(%q)))", out.Name, out.TypeName, out.Header)
 			} else {
-				code.Printf("response.%s = resp.Header.Get(rdl.FoldHttpHeaderName(%q)", out.Name, out.Header)
+				code.Printf("response.%s = resp.Header.Get(rdl.FoldHttpHeaderName(%q))", out.Name, out.Header)
 			}
 		}
 	}
@@ -551,8 +616,12 @@ func (rr *reqRepClientGenerator) convertInput(reg rdl.TypeRegistry, v *rdl.Resou
 		TypeName:       gomodel.GoType2(reg, v.Type, v.Optional, "", "", precise, true, ""),
 	}
 	valueExpr := fmt.Sprintf("req.%s", res.Name)
+	if res.Header != "" {
+		res.HeaderExpression, res.HeaderCondition = goHeaderValue(reg, v, valueExpr, precise)
+		res.HeaderOmittedIfEmpty = v.Optional && !strings.HasPrefix(res.TypeName, "*")
+	}
 	if reg.IsArrayTypeName(v.Type) && res.QueryParameter != "" {
-		res.EncodeParameterExpression = fmt.Sprintf("encodeListParam(\"%s\", %s)", res.QueryParameter, valueExpr)
+		res.EncodeParameterExpression = fmt.Sprintf("encodeListParam(%q, %s, %q)", res.QueryParameter, valueExpr, listStyle(v))
 	} else if res.QueryParameter != "" {
 		baseType := reg.BaseTypeName(v.Type)
 		if v.Optional && baseType != "String" {
@@ -600,8 +669,8 @@ func (rr *reqRepClientGenerator) convertResource(reg rdl.TypeRegistry, r *rdl.Re
 		})
 	}
 	for _, v := range r.Outputs {
-		if input := rr.convertOutput(reg, v, precise); input != nil {
-			method.Inputs = append(method.Inputs, input)
+		if output := rr.convertOutput(reg, v, precise); output != nil {
+			method.Outputs = append(method.Outputs, output)
 		}
 	}
 	method.Resource = r
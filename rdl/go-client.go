@@ -6,8 +6,10 @@ package main
 import (
 	"bufio"
 	"fmt"
+	"log"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"text/template"
 
@@ -103,18 +105,23 @@ package {{package}}
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	rdl "{{rdlruntime}}"
 	"io"
 	"io/ioutil"
+	"math/rand"
 	"net/http"
 	"net/url"
+	"reflect"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
+var _ = context.Background
 var _ = json.Marshal
 var _ = fmt.Printf
 var _ = rdl.BaseTypeAny
@@ -126,11 +133,15 @@ type {{client}} struct {
 	CredsHeader *string
 	CredsToken  *string
 	Timeout     time.Duration
+	Retry         {{client}}RetryPolicy
+	RequestHooks  []{{client}}RequestHook
+	ResponseHooks []{{client}}ResponseHook
+	ctx           context.Context
 }
 
 // NewClient creates and returns a new HTTP client object for the {{.Name}} service
 func NewClient(url string, transport http.RoundTripper) {{client}} {
-	return {{client}}{url, transport, nil, nil, 0}
+	return {{client}}{URL: url, Transport: transport}
 }
 
 // AddCredentials adds the credentials to the client for subsequent requests.
@@ -162,8 +173,17 @@ func (client {{client}}) addAuthHeader(req *http.Request) {
 	}
 }
 
-func (client {{client}}) httpGet(url string, headers map[string]string) (*http.Response, error) {
+func (client {{client}}) httpDo(req *http.Request) (*http.Response, error) {
+	if client.ctx != nil {
+		req = req.WithContext(client.ctx)
+	}
 	hclient := client.getClient()
+	return client.Retry.do(func(req *http.Request) (*http.Response, error) {
+		return client.send(hclient, req)
+	}, req)
+}
+
+func (client {{client}}) httpGet(url string, headers map[string]string) (*http.Response, error) {
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
 		return nil, err
@@ -174,11 +194,10 @@ func (client {{client}}) httpGet(url string, headers map[string]string) (*http.R
 			req.Header.Add(k, v)
 		}
 	}
-	return hclient.Do(req)
+	return client.httpDo(req)
 }
 
 func (client {{client}}) httpDelete(url string, headers map[string]string) (*http.Response, error) {
-	hclient := client.getClient()
 	req, err := http.NewRequest("DELETE", url, nil)
 	if err != nil {
 		return nil, err
@@ -189,7 +208,7 @@ func (client {{client}}) httpDelete(url string, headers map[string]string) (*htt
 			req.Header.Add(k, v)
 		}
 	}
-	return hclient.Do(req)
+	return client.httpDo(req)
 }
 
 func (client {{client}}) httpPut(url string, headers map[string]string, body []byte) (*http.Response, error) {
@@ -197,7 +216,6 @@ func (client {{client}}) httpPut(url string, headers map[string]string, body []b
 	if body != nil {
 		contentReader = bytes.NewReader(body)
 	}
-	hclient := client.getClient()
 	req, err := http.NewRequest("PUT", url, contentReader)
 	if err != nil {
 		return nil, err
@@ -209,7 +227,7 @@ func (client {{client}}) httpPut(url string, headers map[string]string, body []b
 			req.Header.Add(k, v)
 		}
 	}
-	return hclient.Do(req)
+	return client.httpDo(req)
 }
 
 func (client {{client}}) httpPost(url string, headers map[string]string, body []byte) (*http.Response, error) {
@@ -217,7 +235,6 @@ func (client {{client}}) httpPost(url string, headers map[string]string, body []
 	if body != nil {
 		contentReader = bytes.NewReader(body)
 	}
-	hclient := client.getClient()
 	req, err := http.NewRequest("POST", url, contentReader)
 	if err != nil {
 		return nil, err
@@ -229,7 +246,7 @@ func (client {{client}}) httpPost(url string, headers map[string]string, body []
 			req.Header.Add(k, v)
 		}
 	}
-	return hclient.Do(req)
+	return client.httpDo(req)
 }
 
 func (client {{client}}) httpPatch(url string, headers map[string]string, body []byte) (*http.Response, error) {
@@ -237,7 +254,6 @@ func (client {{client}}) httpPatch(url string, headers map[string]string, body [
 	if body != nil {
 		contentReader = bytes.NewReader(body)
 	}
-	hclient := client.getClient()
 	req, err := http.NewRequest("PATCH", url, contentReader)
 	if err != nil {
 		return nil, err
@@ -249,7 +265,7 @@ func (client {{client}}) httpPatch(url string, headers map[string]string, body [
 			req.Header.Add(k, v)
 		}
 	}
-	return hclient.Do(req)
+	return client.httpDo(req)
 }
 
 func (client {{client}}) httpOptions(url string, headers map[string]string, body []byte) (*http.Response, error) {
@@ -257,7 +273,6 @@ func (client {{client}}) httpOptions(url string, headers map[string]string, body
 	if body != nil {
 		contentReader = bytes.NewReader(body)
 	}
-	hclient := client.getClient()
 	req, err := http.NewRequest("OPTIONS", url, contentReader)
 	if err != nil {
 		return nil, err
@@ -271,9 +286,10 @@ func (client {{client}}) httpOptions(url string, headers map[string]string, body
 			req.Header.Add(k, v)
 		}
 	}
-	return hclient.Do(req)
+	return client.httpDo(req)
 }
 
+{{template "hooks" .}}{{template "retry" .}}{{template "exception" .}}
 func encodeStringParam(name string, val string, def string) string {
 	if val == def {
 		return ""
@@ -336,7 +352,10 @@ func encodeFloat64Param(name string, i float64, def float64) string {
 }
 func encodeOptionalEnumParam(name string, e interface{}) string {
 	if e == nil {
-		return "\"\""
+		return ""
+	}
+	if v := reflect.ValueOf(e); v.Kind() == reflect.Ptr && v.IsNil() {
+		return ""
 	}
 	return fmt.Sprintf("&%s=%v", name, e)
 }
@@ -370,6 +389,25 @@ func encodeOptionalUUIDParam(name string, i *rdl.UUID) string {
 	}
 	return "&" + name + "=" + i.String()
 }
+// encodeListParam encodes the items of the list as the query param in the style declared by its
+// x_list_style annotation: "csv" (a=1,2), "brackets" (a[]=1&a[]=2), or else the repeated key (a=1&a=2).
+func encodeListParam(name string, list interface{}, style string) string {
+	v := reflect.ValueOf(list)
+	if v.Kind() != reflect.Slice || v.Len() == 0 {
+		return ""
+	}
+	items := make([]string, v.Len())
+	for i := range items {
+		items[i] = url.QueryEscape(fmt.Sprint(v.Index(i).Interface()))
+	}
+	switch style {
+	case "csv":
+		return "&" + name + "=" + strings.Join(items, ",")
+	case "brackets":
+		name += "[]"
+	}
+	return "&" + name + "=" + strings.Join(items, "&"+name+"=")
+}
 func encodeParams(objs ...string) string {
 	s := strings.Join(objs, "")
 	if s == "" {
@@ -381,7 +419,171 @@ func encodeParams(objs ...string) string {
 func (client {{client}}) {{method_sig .}} {
 {{method_body .}}
 }
-{{end}}`
+{{paginate .}}{{end}}
+{{api}}`
+
+// clientHooksTemplate is shared by the client templates. The hooks are called for every attempt to
+// send a request, so that a retried request gets a fresh token, and every response is observed.
+const clientHooksTemplate = `
+// {{client}}RequestHook is called with every request before it is sent, i.e. to set a bearer token,
+// trace headers or the User-Agent. If it returns an error, the request is not sent.
+type {{client}}RequestHook func(req *http.Request) error
+
+// {{client}}ResponseHook is called after every request with its response, or the error that
+// prevented one, and the time it took.
+type {{client}}ResponseHook func(req *http.Request, resp *http.Response, err error, latency time.Duration)
+
+// AddRequestHook adds a hook to call with every request before it is sent.
+func (client *{{client}}) AddRequestHook(hook {{client}}RequestHook) {
+	client.RequestHooks = append(client.RequestHooks, hook)
+}
+
+// AddResponseHook adds a hook to call with the response to every request.
+func (client *{{client}}) AddResponseHook(hook {{client}}ResponseHook) {
+	client.ResponseHooks = append(client.ResponseHooks, hook)
+}
+
+func (client {{client}}) send(hclient *http.Client, req *http.Request) (*http.Response, error) {
+	for _, hook := range client.RequestHooks {
+		if err := hook(req); err != nil {
+			return nil, err
+		}
+	}
+	start := time.Now()
+	resp, err := hclient.Do(req)
+	for _, hook := range client.ResponseHooks {
+		hook(req, resp, err, time.Since(start))
+	}
+	return resp, err
+}
+`
+
+// clientExceptionTemplate is shared by the client templates.
+const clientExceptionTemplate = `
+// {{client}}Exception is the error returned for a response with a status that the resource declares
+// as an exception of a type other than ResourceError. Body holds the decoded exception, so that
+// callers can reach it with errors.As.
+type {{client}}Exception struct {
+	Code    int
+	Message string
+	Body    interface{}
+}
+
+func (e *{{client}}Exception) Error() string {
+	return fmt.Sprintf("%d %s", e.Code, e.Message)
+}
+`
+
+// clientRetryTemplate is shared by the client templates. By default, requests are sent once. With
+// a MaxAttempts greater than 1, the idempotent ones are retried on connection errors and 5xx
+// responses, after an exponential backoff with jitter, or the delay that a Retry-After asks for.
+const clientRetryTemplate = `
+// {{client}}RetryPolicy controls how the client retries failed requests. The zero value disables retries.
+type {{client}}RetryPolicy struct {
+	// MaxAttempts is the number of times a request is sent at most, including the first one.
+	MaxAttempts int
+	// MinBackoff is the delay before the first retry, which doubles for every next one. Default is 100ms.
+	MinBackoff time.Duration
+	// MaxBackoff is the upper bound of the delay between retries, including the delays asked for by
+	// a Retry-After header. Default is 10s.
+	MaxBackoff time.Duration
+	// RetryNonIdempotent allows POST and PATCH requests to be retried as well.
+	RetryNonIdempotent bool
+	// Retryable decides whether a request is retried after its response or error. By default,
+	// connection errors and 5xx responses are retried.
+	Retryable func(resp *http.Response, err error) bool
+}
+
+func (policy {{client}}RetryPolicy) retries(method string) bool {
+	if policy.MaxAttempts < 2 {
+		return false
+	}
+	switch method {
+	case "GET", "PUT", "DELETE", "OPTIONS", "HEAD":
+		return true
+	}
+	return policy.RetryNonIdempotent
+}
+
+func (policy {{client}}RetryPolicy) retryable(resp *http.Response, err error) bool {
+	if policy.Retryable != nil {
+		return policy.Retryable(resp, err)
+	}
+	if err != nil {
+		return true
+	}
+	return resp.StatusCode >= 500
+}
+
+func (policy {{client}}RetryPolicy) backoff(attempt int, resp *http.Response) time.Duration {
+	min := policy.MinBackoff
+	if min <= 0 {
+		min = 100 * time.Millisecond
+	}
+	max := policy.MaxBackoff
+	if max <= 0 {
+		max = 10 * time.Second
+	}
+	if resp != nil {
+		if after := resp.Header.Get("Retry-After"); after != "" {
+			d := time.Duration(-1)
+			if secs, err := strconv.Atoi(after); err == nil && secs >= 0 {
+				d = time.Duration(secs) * time.Second
+			} else if t, err := http.ParseTime(after); err == nil {
+				d = time.Until(t)
+				if d < 0 {
+					d = 0
+				}
+			}
+			if d > max {
+				d = max
+			}
+			if d >= 0 {
+				return d
+			}
+		}
+	}
+	d := min
+	for i := 1; i < attempt && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+func (policy {{client}}RetryPolicy) do(send func(*http.Request) (*http.Response, error), req *http.Request) (*http.Response, error) {
+	if !policy.retries(req.Method) {
+		return send(req)
+	}
+	for attempt := 1; ; attempt++ {
+		resp, err := send(req)
+		if attempt >= policy.MaxAttempts || req.Context().Err() != nil || !policy.retryable(resp, err) {
+			return resp, err
+		}
+		delay := policy.backoff(attempt, resp)
+		if resp != nil {
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		}
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+	}
+}
+`
 
 func (gen *clientGenerator) emitClient() error {
 	commentFun := func(s string) string {
@@ -419,10 +621,26 @@ func (gen *clientGenerator) emitClient() error {
 		"basename":    basenameFunc,
 		"comment":     commentFun,
 		"method_sig":  func(r *rdl.Resource) string { return goMethodSignature(gen.registry, r, gen.precise) },
-		"method_body": func(r *rdl.Resource) string { return goMethodBody(gen.registry, r, gen.precise) },
+		"method_body": func(r *rdl.Resource) string { return goMethodBody(gen.registry, r, gen.precise, gen.name+"Client") },
 		"client":      func() string { return gen.name + "Client" },
+		"paginate": func(r *rdl.Resource) string {
+			return goClientPaginator(gen.registry, r, gen.precise, gen.name+"Client", false)
+		},
+		"api": func() (string, error) {
+			var sigs []string
+			for _, r := range gen.schema.Resources {
+				sigs = append(sigs, goMethodSignature(gen.registry, r, gen.precise))
+				if sig := goClientPaginatorSignature(gen.registry, r, gen.precise, false); sig != "" {
+					sigs = append(sigs, sig)
+				}
+			}
+			return goClientAPI(gen.name, sigs)
+		},
 	}
 	t := template.Must(template.New("FOO").Funcs(funcMap).Parse(clientTemplate))
+	template.Must(t.New("hooks").Parse(clientHooksTemplate))
+	template.Must(t.New("retry").Parse(clientRetryTemplate))
+	template.Must(t.New("exception").Parse(clientExceptionTemplate))
 	return t.Execute(gen.writer, gen.schema)
 }
 
@@ -477,6 +695,20 @@ func goLiteral(lit interface{}, baseType string) string {
 	}
 }
 
+// listStyle returns the style in which an array query param is encoded, from its x_list_style
+// annotation: "csv", "brackets", or "" for the repeated key. Items in CSV must not contain commas.
+func listStyle(in *rdl.ResourceInput) string {
+	style := string(in.Annotations["x_list_style"])
+	switch style {
+	case "", "csv", "brackets":
+		return style
+	case "repeat":
+		return ""
+	}
+	log.Printf("RDL error: unknown x_list_style %q of queryparam '%s', using repeated keys\n", style, in.Name)
+	return ""
+}
+
 func explodeURL(reg rdl.TypeRegistry, r *rdl.Resource) string {
 	path := r.Path
 	params := ""
@@ -495,7 +727,7 @@ func explodeURL(reg rdl.TypeRegistry, r *rdl.Resource) string {
 			qp := v.QueryParam
 			item := ""
 			if reg.IsArrayTypeName(v.Type) {
-				item = "encodeListParam(\"" + qp + "\"," + gk + ")"
+				item = "encodeListParam(\"" + qp + "\", " + gk + ", \"" + listStyle(v) + "\")"
 			} else {
 				baseType := reg.BaseTypeName(v.Type)
 				if v.Optional && baseType != "String" {
@@ -526,7 +758,7 @@ func explodeURL(reg rdl.TypeRegistry, r *rdl.Resource) string {
 	return path
 }
 
-func goMethodBody(reg rdl.TypeRegistry, r *rdl.Resource, precise bool) string {
+func goMethodBody(reg rdl.TypeRegistry, r *rdl.Resource, precise bool, clientName string) string {
 	rtype := gomodel.GoType(reg, r.Type, false, "", "", precise, true)
 	dataDef := fmt.Sprintf("var data %s", rtype)
 	errorReturn := "return data, err"
@@ -549,25 +781,35 @@ func goMethodBody(reg rdl.TypeRegistry, r *rdl.Resource, precise bool) string {
 		dataReturn = dret
 		errorReturn = eret
 	}
-	headers := map[string]rdl.Identifier{}
+	var headers []*rdl.ResourceInput
 	for _, in := range r.Inputs {
 		if in.Header != "" {
-			headers[in.Header] = in.Name
+			headers = append(headers, in)
 		}
 	}
+	sort.Slice(headers, func(i, j int) bool { return headers[i].Header < headers[j].Header })
 	s := ""
 	if dataDef != "" {
 		s += "\t" + dataDef + "\n"
 	}
 	httpArg := "url, nil"
 	if len(headers) > 0 {
-		//not optimal: when the headers are empty ("") they are still included
+		//optional headers are only sent when set, i.e. not empty
 		httpArg = "url, headers"
 		s += "\theaders := map[string]string{\n"
-		for k, v := range headers {
-			s += fmt.Sprintf("\t\t%q: %s,\n", k, v)
+		for _, in := range headers {
+			if value, cond := goHeaderValue(reg, in, goName(string(in.Name)), precise); cond == "" {
+				s += fmt.Sprintf("\t\t%q: %s,\n", in.Header, value)
+			}
 		}
 		s += "\t}\n"
+		for _, in := range headers {
+			if value, cond := goHeaderValue(reg, in, goName(string(in.Name)), precise); cond != "" {
+				s += "\tif " + cond + " {\n"
+				s += fmt.Sprintf("\t\theaders[%q] = %s\n", in.Header, value)
+				s += "\t}\n"
+			}
+		}
 	}
 	url := explodeURL(reg, r)
 	s += "\turl := client.URL + " + url + "\n"
@@ -663,6 +905,9 @@ func goMethodBody(reg rdl.TypeRegistry, r *rdl.Resource, precise bool) string {
 	}
 	s += "\t\t" + dataReturn + "\n"
 	//end loop
+	s += goClientExceptionCases(reg, r, precise, clientName, assign, func(e string) string {
+		return strings.TrimSuffix(errorReturn, "err") + e
+	})
 	s += "\tdefault:\n"
 	s += "\t\tvar errobj rdl.ResourceError\n"
 	s += "\t\tcontentBytes, err " + assign + " ioutil.ReadAll(resp.Body)\n"
@@ -680,3 +925,62 @@ func goMethodBody(reg rdl.TypeRegistry, r *rdl.Resource, precise bool) string {
 
 	return s
 }
+
+// goHeaderValue returns the expression of the value of the header input, as a string, and the
+// condition for sending it, or "" if it is always sent, i.e. if it is not optional. Optional
+// headers that are not pointers are not sent if empty: the server reads an empty header like an
+// absent one, so the empty value cannot be sent on purpose.
+func goHeaderValue(reg rdl.TypeRegistry, in *rdl.ResourceInput, value string, precise bool) (string, string) {
+	gtype := gomodel.GoType2(reg, in.Type, in.Optional, "", "", precise, true, "")
+	cond := ""
+	if strings.HasPrefix(gtype, "*") {
+		cond = value + " != nil"
+	} else if in.Optional {
+		cond = value + " != \"\""
+	}
+	switch reg.BaseTypeName(in.Type) {
+	case "Bool", "Int8", "Int16", "Int32", "Int64", "Float32", "Float64":
+		if cond != "" {
+			return "fmt.Sprint(*" + value + ")", cond
+		}
+		return "fmt.Sprint(" + value + ")", cond
+	case "Enum", "Timestamp", "UUID":
+		return value + ".String()", cond
+	}
+	if gtype != "string" {
+		return "string(" + value + ")", cond
+	}
+	return value, cond
+}
+
+// goClientExceptionCases returns the cases of the switch on the response status that decode the
+// exceptions declared by the resource into their types, other than ResourceError, and return them
+// as the Body of a <client>Exception. The errorReturn func returns the statement returning an error.
+func goClientExceptionCases(reg rdl.TypeRegistry, r *rdl.Resource, precise bool, clientName string, assign string, errorReturn func(string) string) string {
+	expected := make(map[string]bool)
+	for _, code := range declaredStatusCodes(r) {
+		expected[code] = true
+	}
+	s := ""
+	for _, status := range sortedExceptionCodes(r.Exceptions) {
+		etype := r.Exceptions[status].Type
+		code := rdl.StatusCode(status)
+		if etype == "ResourceError" || expected[code] || reg.FindType(rdl.TypeRef(etype)) == nil {
+			continue
+		}
+		gtype := gomodel.GoType(reg, rdl.TypeRef(etype), false, "", "", precise, true)
+		body := "errobj"
+		if strings.HasPrefix(gtype, "*") {
+			gtype = gtype[1:]
+			body = "&errobj"
+		}
+		s += "\tcase " + code + ":\n"
+		s += "\t\tvar errobj " + gtype + "\n"
+		s += "\t\tcontentBytes, err " + assign + " ioutil.ReadAll(resp.Body)\n"
+		s += "\t\tif err != nil {\n\t\t\t" + errorReturn("err") + "\n\t\t}\n"
+		s += "\t\terr = json.Unmarshal(contentBytes, &errobj)\n"
+		s += "\t\tif err != nil {\n\t\t\t" + errorReturn("err") + "\n\t\t}\n"
+		s += "\t\t" + errorReturn("&"+clientName+"Exception{Code: resp.StatusCode, Message: string(contentBytes), Body: "+body+"}") + "\n"
+	}
+	return s
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/ardielle/ardielle-go/rdl"
+)
+
+// the generated retry policy is tested by building a client in a package of this module, so that
+// it resolves the rdl library without fetching it
+const retryAfterTest = `package retry
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRetryAfterIsCapped(t *testing.T) {
+	policy := RetryClientRetryPolicy{MaxAttempts: 3, MaxBackoff: 2 * time.Second}
+	for _, after := range []string{"3600", time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)} {
+		resp := &http.Response{Header: http.Header{"Retry-After": []string{after}}}
+		if d := policy.backoff(1, resp); d != policy.MaxBackoff {
+			t.Errorf("Retry-After %q: backoff is %v, want %v", after, d, policy.MaxBackoff)
+		}
+	}
+	resp := &http.Response{Header: http.Header{"Retry-After": []string{"1"}}}
+	if d := policy.backoff(1, resp); d != time.Second {
+		t.Errorf("Retry-After 1: backoff is %v, want 1s", d)
+	}
+}
+`
+
+func TestGoClientRetryAfterIsCapped(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds generated code")
+	}
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("the go command is not available")
+	}
+	dir, err := ioutil.TempDir(".", "retrytest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	opts := &generateOptions{
+		schema:  rdl.NewSchemaBuilder("retry").Build(),
+		dirName: dir,
+		librdl:  RdlGoImport,
+	}
+	if err := GenerateGoClient(opts); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "retry_test.go"), []byte(retryAfterTest), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command("go", "test", "./"+dir)
+	cmd.Env = append(os.Environ(), "GOFLAGS=-mod=readonly")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("%v\n%s", err, out)
+	}
+}
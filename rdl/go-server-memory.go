@@ -0,0 +1,189 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ardielle/ardielle-go/gen/gomodel"
+	"github.com/ardielle/ardielle-go/rdl"
+)
+
+// memoryPath returns the path of the resource without its query, and splits off the name of the
+// trailing path param if the resource is an entry of a collection, i.e. "/things/{name}".
+func memoryPath(r *rdl.Resource) (string, string) {
+	path := r.Path
+	if i := strings.Index(path, "?"); i >= 0 {
+		path = path[:i]
+	}
+	path = strings.TrimSuffix(path, "/")
+	i := strings.LastIndex(path, "/")
+	last := path[i+1:]
+	if strings.HasPrefix(last, "{") && strings.HasSuffix(last, "}") {
+		return path[:i], last[1 : len(last)-1]
+	}
+	return path, ""
+}
+
+// memoryPathExpr returns the Go expression for the path, with its params substituted.
+func memoryPathExpr(path string, ref func(string) string) string {
+	var exprs []string
+	for path != "" {
+		i := strings.Index(path, "{")
+		j := strings.Index(path, "}")
+		if i < 0 || j < i {
+			exprs = append(exprs, fmt.Sprintf("%q", path))
+			break
+		}
+		if i > 0 {
+			exprs = append(exprs, fmt.Sprintf("%q", path[:i]))
+		}
+		exprs = append(exprs, "fmt.Sprint("+ref(path[i+1:j])+")")
+		path = path[j+1:]
+	}
+	if len(exprs) == 0 {
+		return "\"\""
+	}
+	return strings.Join(exprs, " + ")
+}
+
+// memoryListField returns the field of the type that holds the entries of a collection, or "" if
+// the type is the array of entries itself. It returns false if the type cannot hold a list.
+func memoryListField(reg rdl.TypeRegistry, typename rdl.TypeRef) (string, bool) {
+	t := reg.FindType(typename)
+	if t == nil {
+		return "", false
+	}
+	switch reg.BaseType(t) {
+	case rdl.BaseTypeArray:
+		return "", true
+	case rdl.BaseTypeStruct:
+		for _, f := range flattenedFields(reg, t) {
+			if f.Items != "" || reg.IsArrayTypeName(f.Type) {
+				return string(f.Name), true
+			}
+		}
+	}
+	return "", false
+}
+
+// memoryKeyField returns the name of the path param of the resources that are entries of the
+// collection at the path, or "" if the schema has none.
+func memoryKeyField(schema *rdl.Schema, path string) string {
+	for _, r := range schema.Resources {
+		if coll, key := memoryPath(r); coll == path && key != "" {
+			return key
+		}
+	}
+	return ""
+}
+
+// goMethodBodyMemory returns the body of the method of the in-memory implementation for the
+// resource. It returns false if the resource is not a collection operation that it understands,
+// in which case the method should be a stub.
+func goMethodBodyMemory(reg rdl.TypeRegistry, schema *rdl.Schema, r *rdl.Resource, precise bool, reqRep bool) (string, bool) {
+	methName, _ := goMethodName(reg, r, precise)
+	ref := func(name string) string {
+		if reqRep {
+			return "input." + capitalize(name)
+		}
+		return goName(name)
+	}
+	body := ""
+	for _, in := range r.Inputs {
+		if in.QueryParam == "" && !in.PathParam && in.Header == "" && in.Context == "" {
+			body = ref(string(in.Name))
+		}
+	}
+	noContent := r.Expected == "NO_CONTENT" && r.Alternatives == nil
+	created := ""
+	for _, code := range declaredStatusCodes(r)[1:] {
+		if code == "201" {
+			created = code
+		}
+	}
+	results := func(status string) string {
+		if reqRep {
+			var fields []string
+			if !noContent {
+				fields = append(fields, "Body: data")
+			}
+			if len(r.Alternatives) > 0 {
+				fields = append(fields, "Status: "+status)
+			}
+			return "&" + capitalize(methName) + "Output{" + strings.Join(fields, ", ") + "}, err"
+		}
+		if noContent {
+			return "err"
+		}
+		s := "data"
+		if len(r.Alternatives) > 0 {
+			s += ", " + status
+		}
+		for _, o := range r.Outputs {
+			s += ", " + goZeroValue(gomodel.GoType2(reg, o.Type, false, "", "", precise, true, ""))
+		}
+		return s + ", err"
+	}
+
+	path, key := memoryPath(r)
+	coll := memoryPathExpr(path, ref)
+	s := ""
+	if !noContent {
+		s += "\tvar data " + gomodel.GoType2(reg, r.Type, false, "", "", precise, true, "") + "\n"
+	}
+	switch strings.ToUpper(r.Method) {
+	case "GET":
+		if noContent {
+			return "", false
+		}
+		if key != "" {
+			s += fmt.Sprintf("\terr := impl.get(%s, fmt.Sprint(%s), &data)\n", coll, ref(key))
+		} else if field, ok := memoryListField(reg, r.Type); ok {
+			s += fmt.Sprintf("\terr := impl.list(%s, %q, &data)\n", coll, field)
+		} else {
+			return "", false
+		}
+		s += "\treturn " + results("0") + "\n"
+	case "PUT", "POST":
+		if body == "" {
+			return "", false
+		}
+		if key != "" {
+			s += fmt.Sprintf("\tkey := fmt.Sprint(%s)\n", ref(key))
+			s += "\tcreated, err := impl.put(" + coll + ", key, " + body + ")\n"
+		} else if field := memoryKeyField(schema, path); field != "" && strings.ToUpper(r.Method) == "POST" {
+			s += fmt.Sprintf("\tkey, err := keyOf(%s, %q)\n", body, field)
+			s += "\tif err != nil {\n"
+			s += "\t\treturn " + results("0") + "\n"
+			s += "\t}\n"
+			s += "\tcreated, err := impl.put(" + coll + ", key, " + body + ")\n"
+		} else {
+			return "", false
+		}
+		if !noContent {
+			s += "\tif err == nil {\n"
+			s += "\t\terr = impl.get(" + coll + ", key, &data)\n"
+			s += "\t}\n"
+		}
+		status := "0"
+		if created != "" && len(r.Alternatives) > 0 {
+			s += "\tstatus := 0\n"
+			s += "\tif created {\n"
+			s += "\t\tstatus = " + created + "\n"
+			s += "\t}\n"
+			status = "status"
+		} else {
+			s += "\t_ = created\n"
+		}
+		s += "\treturn " + results(status) + "\n"
+	case "DELETE":
+		if key == "" {
+			return "", false
+		}
+		s += fmt.Sprintf("\terr := impl.remove(%s, fmt.Sprint(%s))\n", coll, ref(key))
+		s += "\treturn " + results("0") + "\n"
+	default:
+		return "", false
+	}
+	return strings.TrimSuffix(s, "\n"), true
+}
@@ -2,8 +2,11 @@ package main
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"regexp"
 	"strings"
 	"text/template"
 
@@ -47,19 +50,45 @@ func GenerateGoServerProject(opts *generateOptions) error {
 	}
 	implpath := filepath.Join(gendir, name+".go")
 	if !fileExists(implpath) {
-		err = GenerateGoDaemonImpl(opts.banner, schema, gendir, opts.ns, opts.librdl, opts.prefixEnums, opts.preciseTypes, opts.untaggedUnions)
+		err = GenerateGoDaemonImpl(opts.banner, schema, gendir, opts.ns, opts.librdl, opts.prefixEnums, opts.preciseTypes, opts.untaggedUnions, opts.withContext, opts.requestResponse, opts.inMemory)
+		if err != nil {
+			return err
+		}
+	} else if opts.updateImpl || opts.rewriteSignatures {
+		err = UpdateGoDaemonImpl(implpath, schema, opts.librdl, opts.preciseTypes, opts.withContext, opts.requestResponse, opts.rewriteSignatures)
 		if err != nil {
 			return err
 		}
 	}
 
+	modulePath := opts.modulePath
+	existingPath := goModulePath(gendir)
+	if modulePath == "" {
+		modulePath = existingPath
+	} else if existingPath != "" && existingPath != modulePath {
+		return fmt.Errorf("Module path %q does not match the module path %q of the existing go.mod", modulePath, existingPath)
+	}
+	if modulePath == "" {
+		modulePath = opts.ns
+		if modulePath == "" {
+			modulePath = name
+		}
+		if first := strings.Split(modulePath, "/")[0]; !strings.Contains(first, ".") {
+			fmt.Printf("Warning: the module path %q has no dot in its first element, so it may clash with the standard library. Use --module to set another one\n", modulePath)
+		}
+	}
+	err = GenerateGoMod(gendir, modulePath, opts.goModTidy)
+	if err != nil {
+		return err
+	}
+
 	cmddir := filepath.Join(outdir, "cmd")
 	daemondir := filepath.Join(cmddir, name+"d")
 	err = os.MkdirAll(daemondir, 0755)
 	if err != nil {
 		return err
 	}
-	err = GenerateGoDaemonMain(opts.banner, schema, daemondir, opts.ns, opts.librdl, opts.prefixEnums, opts.preciseTypes, opts.untaggedUnions)
+	err = GenerateGoDaemonMain(opts.banner, schema, daemondir, modulePath, opts.librdl, opts.prefixEnums, opts.preciseTypes, opts.untaggedUnions)
 	if err != nil {
 		return err
 	}
@@ -68,18 +97,74 @@ func GenerateGoServerProject(opts *generateOptions) error {
 	if err != nil {
 		return err
 	}
-	err = GenerateGoCLIMain(opts.banner, schema, clidir, opts.ns, opts.librdl, opts.prefixEnums, opts.preciseTypes, opts.untaggedUnions)
+	err = GenerateGoCLIMain(opts.banner, schema, clidir, modulePath, opts.librdl, opts.prefixEnums, opts.preciseTypes, opts.untaggedUnions, opts.requestResponse)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// GenerateGoMod writes the go.mod of the project, unless it already exists, requiring the versions
+// of the libraries that the generated code has been built with, and the go.sum with their hashes.
+// If tidy is set, it then runs "go mod tidy", which needs the go command to be able to fetch the
+// modules.
+func GenerateGoMod(outdir string, modulePath string, tidy bool) error {
+	path := filepath.Join(outdir, "go.mod")
+	if fileExists(path) {
+		return nil
+	}
+	data := "module " + modulePath + "\n\n"
+	data += "go " + GoModGoVersion + "\n\n"
+	data += "require (\n"
+	data += "\t" + ArdielleGoModule + " " + ArdielleGoVersion + "\n"
+	data += "\t" + HttpTreeMuxGoImport + " " + HttpTreeMuxGoVersion + "\n"
+	data += ")\n"
+	err := ioutil.WriteFile(path, []byte(data), 0644)
 	if err != nil {
 		return err
 	}
+	sumpath := filepath.Join(outdir, "go.sum")
+	if !fileExists(sumpath) {
+		sum := ArdielleGoModule + " " + ArdielleGoVersion + " " + ArdielleGoSum + "\n"
+		sum += ArdielleGoModule + " " + ArdielleGoVersion + "/go.mod " + ArdielleGoModSum + "\n"
+		sum += HttpTreeMuxGoImport + " " + HttpTreeMuxGoVersion + " " + HttpTreeMuxGoSum + "\n"
+		sum += HttpTreeMuxGoImport + " " + HttpTreeMuxGoVersion + "/go.mod " + HttpTreeMuxGoModSum + "\n"
+		err = ioutil.WriteFile(sumpath, []byte(sum), 0644)
+		if err != nil {
+			return err
+		}
+	}
+	if !tidy {
+		return nil
+	}
+	cmd := exec.Command("go", "mod", "tidy")
+	cmd.Dir = outdir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		fmt.Println("Warning: could not run 'go mod tidy':", err, strings.TrimSpace(string(out)))
+	}
 	return nil
 }
 
+// goModulePath returns the module path declared by the go.mod in the directory, or "" if there is none.
+func goModulePath(dir string) string {
+	data, err := ioutil.ReadFile(filepath.Join(dir, "go.mod"))
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && fields[0] == "module" {
+			return strings.Trim(fields[1], `"`)
+		}
+	}
+	return ""
+}
+
 func GenerateGoDaemonGenerate(banner string, schema *rdl.Schema, outdir string, ns string) error {
 	return nil
 }
 
-func GenerateGoDaemonMain(banner string, schema *rdl.Schema, outdir string, ns string, librdl string, prefixEnums bool, preciseTypes bool, untaggedUnions []string) error {
+func GenerateGoDaemonMain(banner string, schema *rdl.Schema, outdir string, modulePath string, librdl string, prefixEnums bool, preciseTypes bool, untaggedUnions []string) error {
 	filepath := outdir + "/main.go"
 	out, file, _, err := outputWriter(filepath, "", ".go")
 	if err != nil {
@@ -118,14 +203,8 @@ func GenerateGoDaemonMain(banner string, schema *rdl.Schema, outdir string, ns s
 		return fmt.Sprintf("%s %s%s", fName, fType, fAnno)
 	}
 	funcMap := template.FuncMap{
-		"impl": func() string { return capitalize(name) + "Impl" },
-		"module": func() string {
-			if ns == "" {
-				return "../.."
-			} else {
-				return ns
-			}
-		},
+		"impl":        func() string { return capitalize(name) + "Impl" },
+		"module":      func() string { return modulePath },
 		"rdlruntime":  func() string { return librdl },
 		"header":      func() string { return generationHeader(banner) },
 		"package":     func() string { return generationPackage(schema, "") },
@@ -134,9 +213,10 @@ func GenerateGoDaemonMain(banner string, schema *rdl.Schema, outdir string, ns s
 		"typeRef":     func(t *rdl.Type) string { return makeTypeRef(registry, t, preciseTypes) },
 		"basename":    basenameFunc,
 		"comment":     commentFun,
-		"method_sig":  func(r *rdl.Resource) string { return goMethodSignatureImpl(registry, r, preciseTypes) },
-		"method_body": func(r *rdl.Resource) string { return goMethodBodyImpl(registry, r, preciseTypes) },
+		"method_sig":  func(r *rdl.Resource) string { return goMethodSignatureImpl(registry, r, preciseTypes, false, false) },
+		"method_body": func(r *rdl.Resource) string { return goMethodBodyImpl(registry, r, preciseTypes, false) },
 	}
+	funcMap["envPrefix"] = func() string { return strings.ToUpper(name) + "D_" }
 	t := template.Must(template.New("FOO").Funcs(funcMap).Parse(serverMainTemplate))
 	err = t.Execute(out, schema)
 	if err != nil {
@@ -146,13 +226,19 @@ func GenerateGoDaemonMain(banner string, schema *rdl.Schema, outdir string, ns s
 	return nil
 }
 
-func goMethodSignatureImpl(reg rdl.TypeRegistry, r *rdl.Resource, precise bool) string {
+func goMethodSignatureImpl(reg rdl.TypeRegistry, r *rdl.Resource, precise bool, withContext bool, reqRep bool) string {
+	if reqRep {
+		return goServerMethodSignature(reg, r, precise, withContext, reqRep)
+	}
 	noContent := r.Expected == "NO_CONTENT" && r.Alternatives == nil
 	returnSpec := "error"
 	//fixme: no content *with* output headers
 	if !noContent {
 		gtype := gomodel.GoType2(reg, r.Type, false, "", "", precise, true, "")
 		returnSpec = "(" + gtype
+		if len(r.Alternatives) > 0 {
+			returnSpec += ", int"
+		}
 		if r.Outputs != nil {
 			for _, o := range r.Outputs {
 				otype := gomodel.GoType2(reg, o.Type, false, "", "", precise, true, "")
@@ -163,15 +249,22 @@ func goMethodSignatureImpl(reg rdl.TypeRegistry, r *rdl.Resource, precise bool)
 	}
 	methName, params := goMethodName2(reg, r, precise, "")
 	paramSpec := "context *rdl.ResourceContext"
+	if withContext {
+		paramSpec = "ctx context.Context, " + paramSpec
+	}
 	if len(params) > 0 {
 		paramSpec = paramSpec + ", " + strings.Join(params, ", ")
 	}
 	return capitalize(methName) + "(" + paramSpec + ") " + returnSpec
 }
 
-func goMethodBodyImpl(reg rdl.TypeRegistry, r *rdl.Resource, precise bool) string {
+func goMethodBodyImpl(reg rdl.TypeRegistry, r *rdl.Resource, precise bool, reqRep bool) string {
 	noContent := r.Expected == "NO_CONTENT" && r.Alternatives == nil
 	methName, params := goMethodName2(reg, r, precise, "")
+	if reqRep {
+		s := "\tfmt.Printf(\"" + methName + "(%+v)\\n\", *input)\n"
+		return s + "\treturn nil, &rdl.ResourceError{Code: 501, Message: \"Not Implemented\"}"
+	}
 	args := make([]string, 0)
 	slots := ""
 	for _, sig := range params {
@@ -183,7 +276,29 @@ func goMethodBodyImpl(reg rdl.TypeRegistry, r *rdl.Resource, precise bool) strin
 	if noContent {
 		return s + "\treturn &rdl.ResourceError{Code: 501, Message: \"Not Implemented\"}"
 	}
-	return s + "\treturn nil, &rdl.ResourceError{Code: 501, Message: \"Not Implemented\"}"
+	results := "nil"
+	if len(r.Alternatives) > 0 {
+		results += ", 0"
+	}
+	for _, o := range r.Outputs {
+		results += ", " + goZeroValue(gomodel.GoType2(reg, o.Type, false, "", "", precise, true, ""))
+	}
+	return s + "\treturn " + results + ", &rdl.ResourceError{Code: 501, Message: \"Not Implemented\"}"
+}
+
+// goZeroValue returns an expression for the zero value of the Go type.
+func goZeroValue(gtype string) string {
+	switch {
+	case gtype == "string":
+		return "\"\""
+	case gtype == "bool":
+		return "false"
+	case strings.HasPrefix(gtype, "*"), strings.HasPrefix(gtype, "[]"), strings.HasPrefix(gtype, "map["), gtype == "interface{}":
+		return "nil"
+	case strings.HasPrefix(gtype, "int"), strings.HasPrefix(gtype, "float"):
+		return "0"
+	}
+	return "*new(" + gtype + ")"
 }
 
 var serverMainTemplate = `{{header}}
@@ -191,21 +306,107 @@ var serverMainTemplate = `{{header}}
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	{{package}} "{{module}}"
 )
 
+// Each flag defaults to the value of the environment variable {{envPrefix}}<FLAG>, i.e. {{envPrefix}}ADDR for -addr.
 func main() {
-	endpoint := "localhost:4080"
-	url := "http://" + endpoint + "/{{package}}"
+	addr := flag.String("addr", envString("ADDR", "localhost:4080"), "the address to listen on")
+	baseURL := flag.String("url", envString("URL", ""), "the base URL of the service (default is http(s)://<addr>/{{package}})")
+	certFile := flag.String("cert", envString("CERT", ""), "the TLS certificate file. If set with -key, serve HTTPS")
+	keyFile := flag.String("key", envString("KEY", ""), "the TLS private key file")
+	readTimeout := flag.Duration("read-timeout", envDuration("READ_TIMEOUT", 30*time.Second), "the maximum duration for reading a request")
+	writeTimeout := flag.Duration("write-timeout", envDuration("WRITE_TIMEOUT", 30*time.Second), "the maximum duration for writing a response")
+	idleTimeout := flag.Duration("idle-timeout", envDuration("IDLE_TIMEOUT", 120*time.Second), "the maximum duration to keep an idle connection open")
+	shutdownTimeout := flag.Duration("shutdown-timeout", envDuration("SHUTDOWN_TIMEOUT", 30*time.Second), "the maximum duration to wait for requests to finish on shutdown")
+	metricsPath := flag.String("metrics", envString("METRICS", ""), "the path to serve the Prometheus metrics on, e.g. /metrics (default is not to record them)")
+	flag.Parse()
+
+	tls := *certFile != "" || *keyFile != ""
+	if tls && (*certFile == "" || *keyFile == "") {
+		log.Fatal("both -cert and -key are needed to serve HTTPS")
+	}
+	url := *baseURL
+	if url == "" {
+		scheme := "http"
+		if tls {
+			scheme = "https"
+		}
+		url = scheme + "://" + *addr + "/{{package}}"
+	}
 	impl := new({{package}}.{{impl}})
-	handler := {{package}}.Init(impl, url, impl)
-	http.ListenAndServe(endpoint, handler)
+	service := {{package}}.NewServer(impl, url, impl)
+	if *metricsPath != "" {
+		service.EnableMetrics(*metricsPath)
+	}
+	handler, err := service.Handler()
+	if err != nil {
+		log.Fatal(err)
+	}
+	server := &http.Server{
+		Addr:         *addr,
+		Handler:      handler,
+		ReadTimeout:  *readTimeout,
+		WriteTimeout: *writeTimeout,
+		IdleTimeout:  *idleTimeout,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	errs := make(chan error, 1)
+	go func() {
+		if tls {
+			errs <- server.ListenAndServeTLS(*certFile, *keyFile)
+		} else {
+			errs <- server.ListenAndServe()
+		}
+	}()
+	select {
+	case err = <-errs:
+	case <-ctx.Done():
+		log.Println("Shutting down")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+		defer cancel()
+		err = server.Shutdown(shutdownCtx)
+	}
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal(err)
+	}
+}
+
+func envString(name string, def string) string {
+	if val, ok := os.LookupEnv("{{envPrefix}}" + name); ok {
+		return val
+	}
+	return def
+}
+
+func envDuration(name string, def time.Duration) time.Duration {
+	val, ok := os.LookupEnv("{{envPrefix}}" + name)
+	if !ok {
+		return def
+	}
+	d, err := time.ParseDuration(val)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Bad duration in {{envPrefix}}%s: %v\n", name, err)
+		os.Exit(2)
+	}
+	return d
 }
 `
 
-func GenerateGoDaemonImpl(banner string, schema *rdl.Schema, outdir string, ns string, librdl string, prefixEnums bool, preciseTypes bool, untaggedUnions []string) error {
+func GenerateGoDaemonImpl(banner string, schema *rdl.Schema, outdir string, ns string, librdl string, prefixEnums bool, preciseTypes bool, untaggedUnions []string, withContext bool, reqRep bool, inMemory bool) error {
 	name := strings.ToLower(string(schema.Name))
 	filepath := outdir + "/" + name + ".go"
 	out, file, _, err := outputWriter(filepath, "", ".go")
@@ -244,24 +445,28 @@ func GenerateGoDaemonImpl(banner string, schema *rdl.Schema, outdir string, ns s
 		return fmt.Sprintf("%s %s%s", fName, fType, fAnno)
 	}
 	funcMap := template.FuncMap{
-		"impl": func() string { return capitalize(name) + "Impl" },
-		"module": func() string {
-			if ns == "" {
-				return "../.."
-			} else {
-				return ns
+		"impl":       func() string { return capitalize(name) + "Impl" },
+		"rdlruntime": func() string { return librdl },
+		"header":     func() string { return generationHeader(banner) },
+		"package":    func() string { return generationPackage(schema, "") },
+		"field":      fieldFun,
+		"flattened":  func(t *rdl.Type) []*rdl.StructFieldDef { return flattenedFields(registry, t) },
+		"typeRef":    func(t *rdl.Type) string { return makeTypeRef(registry, t, preciseTypes) },
+		"basename":   basenameFunc,
+		"comment":    commentFun,
+		"method_sig": func(r *rdl.Resource) string {
+			return goMethodSignatureImpl(registry, r, preciseTypes, withContext, reqRep)
+		},
+		"withContext": func() bool { return withContext },
+		"inMemory":    func() bool { return inMemory },
+		"method_body": func(r *rdl.Resource) string {
+			if inMemory {
+				if body, ok := goMethodBodyMemory(registry, schema, r, preciseTypes, reqRep); ok {
+					return body
+				}
 			}
+			return goMethodBodyImpl(registry, r, preciseTypes, reqRep)
 		},
-		"rdlruntime":  func() string { return librdl },
-		"header":      func() string { return generationHeader(banner) },
-		"package":     func() string { return generationPackage(schema, "") },
-		"field":       fieldFun,
-		"flattened":   func(t *rdl.Type) []*rdl.StructFieldDef { return flattenedFields(registry, t) },
-		"typeRef":     func(t *rdl.Type) string { return makeTypeRef(registry, t, preciseTypes) },
-		"basename":    basenameFunc,
-		"comment":     commentFun,
-		"method_sig":  func(r *rdl.Resource) string { return goMethodSignatureImpl(registry, r, preciseTypes) },
-		"method_body": func(r *rdl.Resource) string { return goMethodBodyImpl(registry, r, preciseTypes) },
 	}
 	t := template.Must(template.New("FOO").Funcs(funcMap).Parse(serverImplTemplate))
 	err = t.Execute(out, schema)
@@ -272,15 +477,38 @@ func GenerateGoDaemonImpl(banner string, schema *rdl.Schema, outdir string, ns s
 	return nil
 }
 
-var serverImplTemplate = `{{header}}                                                                                                
+var serverImplTemplate = `{{header}}
 package {{package}}
 
 import(
-	"fmt"
-
+{{if withContext}}	"context"
+{{end}}{{if inMemory}}	"encoding/json"
+{{end}}	"fmt"
+{{if inMemory}}	"net/http"
+	"sort"
+	"sync"
+{{end}}
 	rdl "{{rdlruntime}}"
 )
+{{if inMemory}}
+var _ = fmt.Sprint
 
+// {{impl}} keeps the resources in memory. The collections are inferred from the resource paths,
+// i.e. /things/{name} is an entry of the /things collection, and each entry is held as JSON.
+type {{impl}} struct {
+	mu          sync.Mutex
+	collections map[string]map[string][]byte
+}
+{{range .Resources}}
+func (impl *{{impl}}) {{method_sig .}} {
+{{method_body .}}
+}
+{{end}}
+//Authenticate - required by the framework. If returning true, you should set context.Principal to a valid object
+func (impl *{{impl}}) Authenticate(context *rdl.ResourceContext) bool {
+	return true
+}
+{{else}}
 type {{impl}} struct{}
 {{range .Resources}}
 func (impl {{impl}}) {{method_sig .}} {
@@ -291,18 +519,101 @@ func (impl {{impl}}) {{method_sig .}} {
 func (impl *{{impl}}) Authenticate(context *rdl.ResourceContext) bool {
 	return false
 }
-
+{{end}}
 //Authorize - required by the framework. Enforce authorization here.
 func (impl *{{impl}}) Authorize(action string, resource string, principal rdl.Principal) (bool, error) {
 	return true, nil
 }
-`
+{{if inMemory}}
+func (impl *{{impl}}) collection(path string) map[string][]byte {
+	if impl.collections == nil {
+		impl.collections = make(map[string]map[string][]byte)
+	}
+	c, ok := impl.collections[path]
+	if !ok {
+		c = make(map[string][]byte)
+		impl.collections[path] = c
+	}
+	return c
+}
 
-func GenerateGoCLIMain(banner string, schema *rdl.Schema, outdir string, ns string, librdl string, prefixEnums bool, preciseTypes bool, untaggedUnions []string) error {
-	filepath := outdir + "/main.go"
-	if fileExists(filepath) {
-		return nil
+// put stores the entry in the collection, and returns true if it was created.
+func (impl *{{impl}}) put(path string, key string, value interface{}) (bool, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return false, &rdl.ResourceError{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	impl.mu.Lock()
+	defer impl.mu.Unlock()
+	c := impl.collection(path)
+	_, exists := c[key]
+	c[key] = data
+	return !exists, nil
+}
+
+func (impl *{{impl}}) get(path string, key string, value interface{}) error {
+	impl.mu.Lock()
+	data, ok := impl.collection(path)[key]
+	impl.mu.Unlock()
+	if !ok {
+		return &rdl.ResourceError{Code: http.StatusNotFound, Message: "Not Found"}
+	}
+	return json.Unmarshal(data, value)
+}
+
+func (impl *{{impl}}) remove(path string, key string) error {
+	impl.mu.Lock()
+	defer impl.mu.Unlock()
+	c := impl.collection(path)
+	if _, ok := c[key]; !ok {
+		return &rdl.ResourceError{Code: http.StatusNotFound, Message: "Not Found"}
+	}
+	delete(c, key)
+	return nil
+}
+
+// list decodes the entries of the collection, ordered by key, into the value. If field is not
+// empty, the entries go into that field of the value instead.
+func (impl *{{impl}}) list(path string, field string, value interface{}) error {
+	impl.mu.Lock()
+	c := impl.collection(path)
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	entries := make([]json.RawMessage, 0, len(keys))
+	for _, k := range keys {
+		entries = append(entries, c[k])
+	}
+	impl.mu.Unlock()
+	var data interface{} = entries
+	if field != "" {
+		data = map[string]interface{}{field: entries}
+	}
+	j, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(j, value)
+}
+
+// keyOf returns the field of the entry that is its key in the collection.
+func keyOf(value interface{}, field string) (string, error) {
+	var m map[string]interface{}
+	j, err := json.Marshal(value)
+	if err == nil {
+		err = json.Unmarshal(j, &m)
+	}
+	if err != nil || m[field] == nil {
+		return "", &rdl.ResourceError{Code: http.StatusBadRequest, Message: "Missing " + field}
 	}
+	return fmt.Sprint(m[field]), nil
+}
+{{end}}`
+
+func GenerateGoCLIMain(banner string, schema *rdl.Schema, outdir string, modulePath string, librdl string, prefixEnums bool, preciseTypes bool, untaggedUnions []string, reqRep bool) error {
+	filepath := outdir + "/main.go"
 	out, file, _, err := outputWriter(filepath, "", ".go")
 	if err != nil {
 		return err
@@ -315,7 +626,6 @@ func GenerateGoCLIMain(banner string, schema *rdl.Schema, outdir string, ns stri
 				fmt.Println("Warning: could not format go code:", err, filepath)
 			}
 		}()
-		defer file.Close()
 	}
 	registry := rdl.NewTypeRegistry(schema)
 	commentFun := func(s string) string {
@@ -341,24 +651,25 @@ func GenerateGoCLIMain(banner string, schema *rdl.Schema, outdir string, ns stri
 		return fmt.Sprintf("%s %s%s", fName, fType, fAnno)
 	}
 	funcMap := template.FuncMap{
-		"impl": func() string { return capitalize(name) + "Impl" },
-		"module": func() string {
-			if ns == "" {
-				return "../.."
-			} else {
-				return ns
-			}
+		"impl":       func() string { return capitalize(name) + "Impl" },
+		"module":     func() string { return modulePath },
+		"reqRep":     func() bool { return reqRep },
+		"rdlruntime": func() string { return librdl },
+		"header":     func() string { return generationHeader(banner) },
+		"package":    func() string { return generationPackage(schema, "") },
+		"field":      fieldFun,
+		"flattened":  func(t *rdl.Type) []*rdl.StructFieldDef { return flattenedFields(registry, t) },
+		"typeRef":    func(t *rdl.Type) string { return makeTypeRef(registry, t, preciseTypes) },
+		"basename":   basenameFunc,
+		"comment":    commentFun,
+		"client":     func() string { return capitalize(string(schema.Name)) + "Client" },
+		"envPrefix":  func() string { return strings.ToUpper(name) + "_" },
+		"commandEntry": func(r *rdl.Resource) string {
+			return goCLICommandEntry(registry, r, preciseTypes)
+		},
+		"command": func(r *rdl.Resource) string {
+			return goCLICommand(registry, r, preciseTypes, generationPackage(schema, ""), capitalize(string(schema.Name))+"Client", reqRep)
 		},
-		"rdlruntime":  func() string { return librdl },
-		"header":      func() string { return generationHeader(banner) },
-		"package":     func() string { return generationPackage(schema, "") },
-		"field":       fieldFun,
-		"flattened":   func(t *rdl.Type) []*rdl.StructFieldDef { return flattenedFields(registry, t) },
-		"typeRef":     func(t *rdl.Type) string { return makeTypeRef(registry, t, preciseTypes) },
-		"basename":    basenameFunc,
-		"comment":     commentFun,
-		"method_sig":  func(r *rdl.Resource) string { return goMethodSignature(registry, r, preciseTypes) },
-		"method_body": func(r *rdl.Resource) string { return goMethodBodyImpl(registry, r, preciseTypes) },
 	}
 	t := template.Must(template.New("FOO").Funcs(funcMap).Parse(cliMainTemplate))
 	err = t.Execute(out, schema)
@@ -374,22 +685,304 @@ var cliMainTemplate = `{{header}}
 package main
 
 import (
+{{if reqRep}}	"context"
+{{end}}	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
 
+	rdl "{{rdlruntime}}"
 	{{package}} "{{module}}"
 )
 
+var _ = rdl.BaseTypeAny
+
+type command struct {
+	name        string
+	description string
+	run         func(client *{{package}}.{{client}}, args []string) (interface{}, error)
+}
+
+var commands = []*command{ {{range .Resources}}
+	{{commandEntry .}},{{end}}
+}
+
 func main() {
-	endpoint := "localhost:4080"
-	url := "http://" + endpoint + "/{{package}}"
-	client := {{package}}.NewClient(url, nil)
-	fmt.Println("client:", client)
-	//to do: implement a generic handler for CLI to each API call.
-	/*
-	The following methods are supported by the client:
+	url := flag.String("url", envString("URL", "http://localhost:4080/{{package}}"), "the base URL of the {{package}} service (or set {{envPrefix}}URL)")
+	var headers headerFlags
+	flag.Var(&headers, "H", "a header to send with every request, as 'Name: value'. Can be repeated")
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+	var cmd *command
+	for _, c := range commands {
+		if c.name == flag.Arg(0) {
+			cmd = c
+		}
+	}
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "Unknown command: %s\n", flag.Arg(0))
+		usage()
+		os.Exit(2)
+	}
+	client := {{package}}.NewClient(*url, &headerTransport{headers, http.DefaultTransport})
+	result, err := cmd.run(&client, flag.Args()[1:])
+	if err != nil {
+		var rerr rdl.ResourceError
+		var exc *{{package}}.{{client}}Exception
+		if errors.As(err, &rerr) {
+			printJSON(os.Stderr, rerr)
+		} else if errors.As(err, &exc) {
+			printJSON(os.Stderr, exc.Body)
+		} else {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+		}
+		os.Exit(1)
+	}
+	if result != nil {
+		printJSON(os.Stdout, result)
+	}
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s [-url URL] [-H 'Name: value'] COMMAND [FLAGS]\n\nCommands:\n", os.Args[0])
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-24s %s\n", c.name, c.description)
+	}
+	fmt.Fprintf(os.Stderr, "\nRun '%s COMMAND -h' to see the flags of a command.\n", os.Args[0])
+}
+
+func envString(name string, def string) string {
+	if val, ok := os.LookupEnv("{{envPrefix}}" + name); ok {
+		return val
+	}
+	return def
+}
+
+func printJSON(out *os.File, data interface{}) {
+	j, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+	fmt.Fprintln(out, string(j))
+}
+
+func printHeader(name string, value interface{}) {
+	fmt.Fprintf(os.Stderr, "%s: %v\n", name, value)
+}
+
+// parseArgs parses the value of every flag that is set, or has a default, into its target. The
+// values are JSON, but strings need not be quoted, and arrays may also be given as comma-separated
+// items.
+func parseArgs(flags *flag.FlagSet, required []string, targets map[string]interface{}) error {
+	var err error
+	flags.VisitAll(func(f *flag.Flag) {
+		target, ok := targets[f.Name]
+		if !ok || err != nil || f.Value.String() == "" {
+			return
+		}
+		if e := parseValue(f.Value.String(), target); e != nil {
+			err = fmt.Errorf("bad value for -%s: %v", f.Name, e)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	for _, name := range required {
+		if flags.Lookup(name).Value.String() == "" {
+			return fmt.Errorf("missing -%s", name)
+		}
+	}
+	return nil
+}
+
+// parseValue decodes the value into the target as JSON, else as comma-separated items if the target
+// is a slice, else as a string.
+func parseValue(val string, target interface{}) error {
+	if json.Unmarshal([]byte(val), target) == nil {
+		return nil
+	}
+	if v := reflect.ValueOf(target).Elem(); v.Kind() == reflect.Slice && !strings.HasPrefix(val, "[") {
+		items := reflect.MakeSlice(v.Type(), 0, 0)
+		for _, s := range strings.Split(val, ",") {
+			item := reflect.New(v.Type().Elem())
+			if err := parseValue(s, item.Interface()); err != nil {
+				return err
+			}
+			items = reflect.Append(items, item.Elem())
+		}
+		v.Set(items)
+		return nil
+	}
+	quoted, _ := json.Marshal(val)
+	return json.Unmarshal(quoted, target)
+}
+
+// readBody decodes the JSON in the file into the target, reading stdin if the file is "-".
+func readBody(file string, target interface{}) error {
+	var data []byte
+	var err error
+	if file == "-" {
+		data, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		data, err = ioutil.ReadFile(file)
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, target)
+}
+
+type headerFlags []string
+
+func (h *headerFlags) String() string {
+	return strings.Join(*h, ", ")
+}
+
+func (h *headerFlags) Set(value string) error {
+	if !strings.Contains(value, ":") {
+		return fmt.Errorf("header must be 'Name: value'")
+	}
+	*h = append(*h, value)
+	return nil
+}
+
+type headerTransport struct {
+	headers []string
+	base    http.RoundTripper
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for _, h := range t.headers {
+		i := strings.Index(h, ":")
+		req.Header.Set(strings.TrimSpace(h[:i]), strings.TrimSpace(h[i+1:]))
+	}
+	return t.base.RoundTrip(req)
+}
 {{range .Resources}}
-	client.{{method_sig .}}
-{{end}}
-	*/
+{{command .}}
+{{end}}`
+
+// goCLICommandEntry returns the entry in the commands table of the CLI for the resource.
+func goCLICommandEntry(reg rdl.TypeRegistry, r *rdl.Resource, precise bool) string {
+	methName, _ := goMethodName(reg, r, precise)
+	description := strings.ToUpper(r.Method) + " " + r.Path
+	if comment := strings.TrimSpace(r.Comment); comment != "" {
+		description += " - " + strings.Split(comment, "\n")[0]
+	}
+	return fmt.Sprintf("{%q, %q, %sCommand}", methName, description, methName)
+}
+
+// qualifiedTypeNames matches the names of the schema's types in a Go type, i.e. Color in "*Color"
+// but not Timestamp in "rdl.Timestamp", so that they can be qualified with the package name.
+var qualifiedTypeNames = regexp.MustCompile(`(^|[^.\w])([A-Z]\w*)`)
+
+// goCLICommand returns the function of the CLI that runs the command for the resource. Every input
+// is a flag, with the body read as JSON from the file named by its flag.
+func goCLICommand(reg rdl.TypeRegistry, r *rdl.Resource, precise bool, pkg string, client string, reqRep bool) string {
+	methName, params := goMethodName(reg, r, precise)
+	s := "func " + methName + "Command(client *" + pkg + "." + client + ", args []string) (interface{}, error) {\n"
+	s += fmt.Sprintf("\tflags := flag.NewFlagSet(%q, flag.ExitOnError)\n", methName)
+	decls := ""
+	targets := ""
+	var required []string
+	var args []string
+	body := ""
+	i := 0
+	for _, in := range r.Inputs {
+		if in.Context != "" { //legacy field, to be removed
+			continue
+		}
+		gtype := qualifiedTypeNames.ReplaceAllString(params[i][strings.Index(params[i], " ")+1:], "${1}"+pkg+".$2")
+		i++
+		name := string(in.Name)
+		arg := "arg" + capitalize(name)
+		args = append(args, arg)
+		decls += "\tvar " + arg + " " + gtype + "\n"
+		usage := string(in.Type)
+		if in.PathParam {
+			usage += ", path param (required)"
+			required = append(required, fmt.Sprintf("%q", name))
+		} else if in.QueryParam != "" {
+			usage += ", query param '" + in.QueryParam + "'"
+		} else if in.Header != "" {
+			usage += ", header '" + in.Header + "'"
+		} else {
+			usage = "file with the " + usage + " body as JSON, or - for stdin"
+			s += fmt.Sprintf("\t%sFile := flags.String(%q, \"-\", %q)\n", arg, name, usage)
+			body = fmt.Sprintf("\tif err := readBody(*%sFile, &%s); err != nil {\n\t\treturn nil, err\n\t}\n", arg, arg)
+			continue
+		}
+		if reg.IsArrayTypeName(in.Type) {
+			usage += ", comma-separated items or a JSON array"
+		}
+		if in.Optional {
+			usage += " (optional)"
+		}
+		def := ""
+		if in.Default != nil {
+			def = fmt.Sprint(in.Default)
+		}
+		s += fmt.Sprintf("\tflags.String(%q, %q, %q)\n", name, def, usage)
+		targets += fmt.Sprintf("\t\t%q: &%s,\n", name, arg)
+	}
+	s += "\tflags.Parse(args)\n"
+	s += decls
+	if targets != "" || len(required) > 0 {
+		s += "\terr := parseArgs(flags, []string{" + strings.Join(required, ", ") + "}, map[string]interface{}{\n" + targets + "\t})\n"
+		s += "\tif err != nil {\n\t\treturn nil, err\n\t}\n"
+	}
+	s += body
+	call := "client." + capitalize(methName) + "(" + strings.Join(args, ", ") + ")"
+	noContent := r.Expected == "NO_CONTENT" && r.Alternatives == nil
+	if reqRep {
+		var fields []string
+		for _, in := range r.Inputs {
+			if in.Context == "" {
+				fields = append(fields, capitalize(goName(string(in.Name)))+": arg"+capitalize(string(in.Name)))
+			}
+		}
+		call = "client." + capitalize(methName) + "(context.Background(), &" + pkg + "." + capitalize(methName) + "Request{" + strings.Join(fields, ", ") + "})"
+		if noContent && len(r.Outputs) == 0 {
+			s += "\tif _, err := " + call + "; err != nil {\n\t\treturn nil, err\n\t}\n"
+		} else {
+			s += "\tresp, err := " + call + "\n"
+			s += "\tif err != nil {\n\t\treturn nil, err\n\t}\n"
+		}
+		for _, o := range r.Outputs {
+			s += fmt.Sprintf("\tprintHeader(%q, resp.%s)\n", o.Header, capitalize(goName(string(o.Name))))
+		}
+		if noContent {
+			s += "\treturn nil, nil\n"
+		} else {
+			s += "\treturn resp.Body, nil\n"
+		}
+	} else if noContent {
+		s += "\treturn nil, " + call + "\n"
+	} else {
+		results := "data"
+		for _, o := range r.Outputs {
+			results += ", " + string(o.Name)
+		}
+		s += "\t" + results + ", err := " + call + "\n"
+		if len(r.Outputs) > 0 {
+			s += "\tif err == nil {\n"
+			for _, o := range r.Outputs {
+				s += fmt.Sprintf("\t\tprintHeader(%q, %s)\n", o.Header, string(o.Name))
+			}
+			s += "\t}\n"
+		}
+		s += "\treturn data, err\n"
+	}
+	s += "}\n"
+	return s
 }
-`
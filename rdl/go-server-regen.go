@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ardielle/ardielle-go/rdl"
+)
+
+// UpdateGoDaemonImpl brings the existing implementation of a server project up to date with the
+// schema: it adds a stub for every handler method that is missing, and reports the methods whose
+// signatures don't match the schema anymore. If rewrite is set, their signatures are replaced with
+// the expected ones, and their bodies are kept.
+func UpdateGoDaemonImpl(implpath string, schema *rdl.Schema, librdl string, preciseTypes bool, withContext bool, reqRep bool, rewrite bool) error {
+	src, err := ioutil.ReadFile(implpath)
+	if err != nil {
+		return err
+	}
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, implpath, src, parser.ParseComments)
+	if err != nil {
+		return fmt.Errorf("Cannot parse the implementation %q: %v", implpath, err)
+	}
+	implType := capitalize(strings.ToLower(string(schema.Name))) + "Impl"
+	existing := make(map[string]*ast.FuncDecl)
+	recv := ""
+	for _, d := range file.Decls {
+		fd, ok := d.(*ast.FuncDecl)
+		if !ok || fd.Recv == nil || len(fd.Recv.List) != 1 {
+			continue
+		}
+		field := fd.Recv.List[0]
+		typeName := nodeString(fset, field.Type)
+		if strings.TrimPrefix(typeName, "*") != implType {
+			continue
+		}
+		existing[fd.Name.Name] = fd
+		if recv == "" && fd.Name.Name != "Authenticate" && fd.Name.Name != "Authorize" {
+			recv = typeName
+			if len(field.Names) > 0 {
+				recv = field.Names[0].Name + " " + typeName
+			}
+		}
+	}
+	if recv == "" {
+		recv = "impl " + implType
+	}
+
+	registry := rdl.NewTypeRegistry(schema)
+	type edit struct {
+		start, end int
+		text       string
+	}
+	var edits []edit
+	stubs := ""
+	expected := make(map[string]bool)
+	for _, r := range schema.Resources {
+		sig := goMethodSignatureImpl(registry, r, preciseTypes, withContext, reqRep)
+		want, err := parseMethodType(sig)
+		if err != nil {
+			return err
+		}
+		name := sig[:strings.Index(sig, "(")]
+		expected[name] = true
+		m, ok := existing[name]
+		if !ok {
+			stubs += "\nfunc (" + recv + ") " + sig + " {\n" + goMethodBodyImpl(registry, r, preciseTypes, reqRep) + "\n}\n"
+			fmt.Printf("Added method %s to %s\n", name, implpath)
+			continue
+		}
+		have := funcTypeString(fset, m.Type)
+		if have == funcTypeString(want.fset, want.decl.Type) {
+			continue
+		}
+		if rewrite {
+			ft := m.Type
+			start := fset.Position(ft.Params.Pos()).Offset
+			end := fset.Position(ft.End()).Offset
+			wft := want.decl.Type
+			text := want.src[want.fset.Position(wft.Params.Pos()).Offset:want.fset.Position(wft.End()).Offset]
+			edits = append(edits, edit{start, end, text})
+			fmt.Printf("Rewrote the signature of method %s in %s\n", name, implpath)
+		} else {
+			fmt.Printf("Warning: method %s in %s has signature %s, the schema needs %s\n", name, implpath, have, funcTypeString(want.fset, want.decl.Type))
+		}
+	}
+	for name := range existing {
+		if !expected[name] && name != "Authenticate" && name != "Authorize" && ast.IsExported(name) {
+			fmt.Printf("Warning: method %s in %s is not a resource of the schema\n", name, implpath)
+		}
+	}
+	if len(edits) == 0 && stubs == "" {
+		return nil
+	}
+
+	//apply the edits from the end, so that the offsets of the others stay valid
+	sort.Slice(edits, func(i, j int) bool { return edits[i].start > edits[j].start })
+	out := string(src)
+	added := stubs
+	for _, e := range edits {
+		out = out[:e.start] + e.text + out[e.end:]
+		added += e.text
+	}
+	//the imports are inserted after the package clause, which precedes all the edits
+	var imports []string
+	if stubs != "" {
+		imports = append(imports, "fmt")
+	}
+	if strings.Contains(added, "rdl.") {
+		imports = append(imports, librdl)
+	}
+	if strings.Contains(added, "context.Context") {
+		imports = append(imports, "context")
+	}
+	out = addImports(fset, file, out, imports)
+	out += stubs
+	err = ioutil.WriteFile(implpath, []byte(out), 0644)
+	if err != nil {
+		return err
+	}
+	err = goFmt(implpath)
+	if err != nil {
+		fmt.Println("Warning: could not format go code:", err, implpath)
+	}
+	return nil
+}
+
+type parsedMethod struct {
+	fset *token.FileSet
+	src  string
+	decl *ast.FuncDecl
+}
+
+// parseMethodType parses a method signature, as generated for the implementation.
+func parseMethodType(sig string) (*parsedMethod, error) {
+	src := "package p\n\nfunc (impl T) " + sig + " {}\n"
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", src, 0)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot parse generated signature %q: %v", sig, err)
+	}
+	return &parsedMethod{fset, src, file.Decls[0].(*ast.FuncDecl)}, nil
+}
+
+func nodeString(fset *token.FileSet, node interface{}) string {
+	var buf bytes.Buffer
+	printer.Fprint(&buf, fset, node)
+	return buf.String()
+}
+
+// funcTypeString returns the parameter and result types of the function type, without the
+// names, i.e. "(string, int32) (*Thing, error)", which is all that has to match.
+func funcTypeString(fset *token.FileSet, ft *ast.FuncType) string {
+	types := func(fields *ast.FieldList) string {
+		if fields == nil {
+			return ""
+		}
+		var list []string
+		for _, f := range fields.List {
+			t := nodeString(fset, f.Type)
+			n := len(f.Names)
+			if n == 0 {
+				n = 1
+			}
+			for i := 0; i < n; i++ {
+				list = append(list, t)
+			}
+		}
+		return strings.Join(list, ", ")
+	}
+	return "(" + types(ft.Params) + ") (" + types(ft.Results) + ")"
+}
+
+// addImports adds the import paths that the file doesn't import yet to its source.
+func addImports(fset *token.FileSet, file *ast.File, src string, paths []string) string {
+	have := make(map[string]bool)
+	for _, spec := range file.Imports {
+		p, _ := strconv.Unquote(spec.Path.Value)
+		have[p] = true
+	}
+	lines := ""
+	for _, p := range paths {
+		if !have[p] {
+			if p == RdlGoImport || strings.HasSuffix(p, "/rdl") {
+				lines += "\trdl " + strconv.Quote(p) + "\n"
+			} else {
+				lines += "\t" + strconv.Quote(p) + "\n"
+			}
+			have[p] = true
+		}
+	}
+	if lines == "" {
+		return src
+	}
+	offset := fset.Position(file.Name.End()).Offset
+	return src[:offset] + "\n\nimport (\n" + lines + ")" + src[offset:]
+}
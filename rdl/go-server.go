@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"log"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"text/template"
 
@@ -26,6 +27,10 @@ type serverGenerator struct {
 	precise     bool
 	ns          string
 	librdl      string
+	validate    bool
+	withContext bool
+	reqRep      bool
+	untagged    []string
 }
 
 // GenerateGoServer generates the server code for the RDL-defined service
@@ -62,7 +67,21 @@ func GenerateGoServer(opts *generateOptions) error {
 		}()
 	}
 	reg := rdl.NewTypeRegistry(schema)
-	gen := &serverGenerator{reg, schema, capitalize(string(schema.Name)), out, nil, banner, prefixEnums, precise, ns, librdl}
+	gen := &serverGenerator{
+		registry:    reg,
+		schema:      schema,
+		name:        capitalize(string(schema.Name)),
+		writer:      out,
+		banner:      banner,
+		prefixEnums: prefixEnums,
+		precise:     precise,
+		ns:          ns,
+		librdl:      librdl,
+		validate:    opts.validate,
+		withContext: opts.withContext,
+		reqRep:      opts.requestResponse,
+		untagged:    opts.untaggedUnions,
+	}
 	gen.processTemplate(serverTemplate)
 	out.Flush()
 	return gen.err
@@ -73,13 +92,20 @@ const serverTemplate = `{{header}}
 package {{package}}
 
 import (
-	"encoding/json"
+{{if withContext}}	"context"
+{{end}}	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"log"
+	"log/slog"
 	"net/http"
 	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	rdl "{{rdlruntime}}"
 	"{{httptreemux}}"
@@ -91,27 +117,164 @@ var _ = ioutil.Discard
 //
 // Init initializes the {{name}} server with a service identity and an
 // implementation ({{cName}}Handler), and returns an http.Handler to serve it.
+// It exits if the base URL cannot be parsed. Use NewServer instead to get that
+// error from Handler, or to wrap the resource handlers in middleware.
 //
 func Init(impl {{cName}}Handler, baseURL string, authz rdl.Authorizer, authns ...rdl.Authenticator) http.Handler {
-	u, err := url.Parse(strings.TrimSuffix(baseURL, "/"))
+	handler, err := NewServer(impl, baseURL, authz, authns...).Handler()
 	if err != nil {
 		log.Fatal(err)
 	}
+	return handler
+}
+
+//
+// {{cName}}Logger receives the events of the {{name}} server. The args are alternating keys and
+// values, with the keys "resource", "principal" and "outcome" describing the request. A *slog.Logger
+// satisfies this interface, and slog.Default() is used unless SetLogger is called.
+//
+type {{cName}}Logger interface {
+	Info(msg string, args ...interface{})
+	Warn(msg string, args ...interface{})
+	Error(msg string, args ...interface{})
+}
+
+//
+// {{cName}}Resource describes the resource a request has been routed to.
+//
+type {{cName}}Resource struct {
+	Name   string // the name of the handler method, i.e. "{{firstMethodName}}"
+	Method string // the HTTP method
+	Path   string // the path template, relative to the base URL
+}
+
+//
+// {{cName}}HandlerFunc handles a request for a resource of the {{name}} service.
+//
+type {{cName}}HandlerFunc func(resource *{{cName}}Resource, context *rdl.ResourceContext)
+
+//
+// {{cName}}Middleware wraps a {{cName}}HandlerFunc. The returned function normally does its own
+// work around a call to next, and may replace context.Writer to observe the response.
+//
+type {{cName}}Middleware func(next {{cName}}HandlerFunc) {{cName}}HandlerFunc
+
+//
+// {{server}} collects the implementation and middleware of the {{name}} service. Call
+// Handler to get the http.Handler that serves it.
+//
+type {{server}} struct {
+	impl               {{cName}}Handler
+	baseURL            string
+	authorizer         rdl.Authorizer
+	authenticators     []rdl.Authenticator
+	middleware         []{{cName}}Middleware
+	resourceMiddleware map[string][]{{cName}}Middleware
+	logger             {{cName}}Logger
+	metrics            *requestMetrics
+	metricsPath        string
+}
+
+//
+// NewServer creates a {{server}} for the implementation ({{cName}}Handler) at the base URL.
+//
+func NewServer(impl {{cName}}Handler, baseURL string, authz rdl.Authorizer, authns ...rdl.Authenticator) *{{server}} {
+	return &{{server}}{
+		impl:               impl,
+		baseURL:            baseURL,
+		authorizer:         authz,
+		authenticators:     authns,
+		resourceMiddleware: make(map[string][]{{cName}}Middleware),
+		logger:             slog.Default(),
+	}
+}
+
+//
+// SetLogger replaces the logger that receives the events of the server.
+//
+func (server *{{server}}) SetLogger(logger {{cName}}Logger) *{{server}} {
+	server.logger = logger
+	return server
+}
+
+//
+// Use adds middleware around every resource handler. Middleware added first is outermost.
+//
+func (server *{{server}}) Use(middleware ...{{cName}}Middleware) *{{server}} {
+	server.middleware = append(server.middleware, middleware...)
+	return server
+}
+
+//
+// UseFor adds middleware around the handler of the named resource only, inside any
+// middleware added with Use. The name is that of the handler method, i.e. "{{firstMethodName}}".
+//
+func (server *{{server}}) UseFor(resource string, middleware ...{{cName}}Middleware) *{{server}} {
+	server.resourceMiddleware[resource] = append(server.resourceMiddleware[resource], middleware...)
+	return server
+}
+
+//
+// EnableMetrics records the number of requests handled by each resource by status, their latency,
+// and the number of requests in flight, labelled with the name of the handler method and the HTTP
+// method. They are served in the Prometheus text format at the path on the server, which is not
+// relative to the base URL, and is "/metrics" if empty.
+//
+func (server *{{server}}) EnableMetrics(path string) *{{server}} {
+	if path == "" {
+		path = "/metrics"
+	}
+	server.metrics = newRequestMetrics("{{metricsPrefix}}")
+	server.metricsPath = path
+	return server
+}
+
+//
+// Handler returns an http.Handler that routes requests to the resource handlers, or an error
+// if the base URL cannot be parsed.
+//
+func (server *{{server}}) Handler() (http.Handler, error) {
+	u, err := url.Parse(strings.TrimSuffix(server.baseURL, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("bad base URL for the {{name}} service: %v", err)
+	}
 	b := u.Path
 	router := httptreemux.New()
-	adaptor := {{name}}Adaptor{impl, authz, authns, b}
+	adaptor := {{name}}Adaptor{server.impl, server.authorizer, server.authenticators, b, server.logger}
 {{range .Resources}}
-	router.{{uMethod .}}(b+"{{methodPath .}}", func(w http.ResponseWriter, r *http.Request, ps map[string]string) {
-		adaptor.{{handlerName .}}(w, r, ps)
-	}){{end}}
+	router.{{uMethod .}}(b+"{{methodPath .}}", server.route({{resourceInfo .}}, adaptor.{{handlerName .}})){{end}}
+	if server.metrics != nil {
+		router.GET(server.metricsPath, func(w http.ResponseWriter, r *http.Request, ps map[string]string) {
+			server.metrics.serve(w)
+		})
+	}
 	router.NotFoundHandler = func(w http.ResponseWriter, r *http.Request) {
 		rdl.JSONResponse(w, 404, rdl.ResourceError{Code: http.StatusNotFound, Message: "Not Found"})
 	}
-	log.Printf("Initialized {{name}} service at '%s'\n", baseURL)
-	return router
+	server.logger.Info("initialized service", "service", "{{name}}", "baseURL", server.baseURL)
+	return router, nil
 }
 
-//
+func (server *{{server}}) route(resource *{{cName}}Resource, handler func(*rdl.ResourceContext, http.ResponseWriter, *http.Request)) httptreemux.HandlerFunc {
+	h := func(resource *{{cName}}Resource, context *rdl.ResourceContext) {
+		handler(context, context.Writer, context.Request)
+	}
+	var chain []{{cName}}Middleware
+	chain = append(chain, server.middleware...)
+	chain = append(chain, server.resourceMiddleware[resource.Name]...)
+	for i := len(chain) - 1; i >= 0; i-- {
+		h = chain[i](h)
+	}
+	if server.metrics != nil {
+		h = server.metrics.middleware(resource, h)
+	}
+	return func(w http.ResponseWriter, r *http.Request, ps map[string]string) {
+		h(resource, &rdl.ResourceContext{Writer: w, Request: r, Params: ps, Principal: nil})
+	}
+}
+
+{{if reqRep}}{{range .Resources}}{{reqRepTypes .}}{{end}}
+{{end}}//
 // {{cName}}Handler is the interface that the service implementation must conform to
 //
 type {{cName}}Handler interface {{openBrace}}{{range .Resources}}
@@ -119,6 +282,20 @@ type {{cName}}Handler interface {{openBrace}}{{range .Resources}}
 	Authenticate(context *rdl.ResourceContext) bool
 }
 
+//
+// {{cName}}Exception is an error that a handler method returns to respond with one of the
+// exceptions declared by the resources, using the declared type for the response body.
+// Create it with one of the New... constructors that follow.
+//
+type {{cName}}Exception struct {
+	Code int
+	Body interface{}
+}
+
+func (e *{{cName}}Exception) Error() string {
+	return fmt.Sprintf("%d %s", e.Code, http.StatusText(e.Code))
+}
+{{exceptionConstructors}}
 //
 // {{name}}Adaptor - this adapts the http-oriented router calls to the non-http service handler.
 //
@@ -127,9 +304,185 @@ type {{name}}Adaptor struct {
 	authorizer     rdl.Authorizer
 	authenticators []rdl.Authenticator
 	endpoint       string
+	logger         {{cName}}Logger
+}
+
+func principalName(context *rdl.ResourceContext) string {
+	if context.Principal == nil {
+		return ""
+	}
+	return context.Principal.GetDomain() + "." + context.Principal.GetName()
 }
 
-func (adaptor {{name}}Adaptor) authenticate(context *rdl.ResourceContext) bool {
+// metricsBuckets are the upper bounds of the buckets of the latency histograms, in seconds.
+var metricsBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+type metricsKey struct {
+	resource string
+	method   string
+}
+
+type latencyHistogram struct {
+	buckets []uint64 // the cumulative counts of the observations up to each of metricsBuckets
+	sum     float64
+	count   uint64
+}
+
+// requestMetrics holds the metrics of the requests handled by the server, per resource.
+type requestMetrics struct {
+	prefix   string
+	mu       sync.Mutex
+	requests map[metricsKey]map[int]uint64
+	latency  map[metricsKey]*latencyHistogram
+	inFlight map[metricsKey]int64
+}
+
+func newRequestMetrics(prefix string) *requestMetrics {
+	return &requestMetrics{
+		prefix:   prefix,
+		requests: make(map[metricsKey]map[int]uint64),
+		latency:  make(map[metricsKey]*latencyHistogram),
+		inFlight: make(map[metricsKey]int64),
+	}
+}
+
+// middleware registers the resource, so that its metrics are served before it gets requests, and
+// returns the middleware recording them around the handler.
+func (m *requestMetrics) middleware(resource *{{cName}}Resource, next {{cName}}HandlerFunc) {{cName}}HandlerFunc {
+	key := metricsKey{resource.Name, resource.Method}
+	m.mu.Lock()
+	m.requests[key] = make(map[int]uint64)
+	m.latency[key] = &latencyHistogram{buckets: make([]uint64, len(metricsBuckets))}
+	m.inFlight[key] = 0
+	m.mu.Unlock()
+	return func(resource *{{cName}}Resource, context *rdl.ResourceContext) {
+		m.mu.Lock()
+		m.inFlight[key]++
+		m.mu.Unlock()
+		writer := &metricsWriter{ResponseWriter: context.Writer}
+		context.Writer = writer
+		start := time.Now()
+		defer func() {
+			m.observe(key, writer.status, time.Since(start))
+		}()
+		next(resource, context)
+	}
+}
+
+func (m *requestMetrics) observe(key metricsKey, status int, elapsed time.Duration) {
+	if status == 0 {
+		status = http.StatusOK
+	}
+	seconds := elapsed.Seconds()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.inFlight[key]--
+	m.requests[key][status]++
+	h := m.latency[key]
+	for i, le := range metricsBuckets {
+		if seconds <= le {
+			h.buckets[i]++
+		}
+	}
+	h.sum += seconds
+	h.count++
+}
+
+// serve writes the metrics in the Prometheus text exposition format.
+func (m *requestMetrics) serve(writer http.ResponseWriter) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var keys []metricsKey
+	for key := range m.inFlight {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].resource != keys[j].resource {
+			return keys[i].resource < keys[j].resource
+		}
+		return keys[i].method < keys[j].method
+	})
+	var b strings.Builder
+	name := m.prefix + "_requests_total"
+	fmt.Fprintf(&b, "# HELP %s The number of requests handled, by resource, method and status.\n", name)
+	fmt.Fprintf(&b, "# TYPE %s counter\n", name)
+	for _, key := range keys {
+		var statuses []int
+		for status := range m.requests[key] {
+			statuses = append(statuses, status)
+		}
+		sort.Ints(statuses)
+		for _, status := range statuses {
+			fmt.Fprintf(&b, "%s{resource=%q,method=%q,status=\"%d\"} %d\n", name, key.resource, key.method, status, m.requests[key][status])
+		}
+	}
+	name = m.prefix + "_request_duration_seconds"
+	fmt.Fprintf(&b, "# HELP %s The latency of the requests, by resource and method.\n", name)
+	fmt.Fprintf(&b, "# TYPE %s histogram\n", name)
+	for _, key := range keys {
+		h := m.latency[key]
+		for i, le := range metricsBuckets {
+			fmt.Fprintf(&b, "%s_bucket{resource=%q,method=%q,le=\"%g\"} %d\n", name, key.resource, key.method, le, h.buckets[i])
+		}
+		fmt.Fprintf(&b, "%s_bucket{resource=%q,method=%q,le=\"+Inf\"} %d\n", name, key.resource, key.method, h.count)
+		fmt.Fprintf(&b, "%s_sum{resource=%q,method=%q} %g\n", name, key.resource, key.method, h.sum)
+		fmt.Fprintf(&b, "%s_count{resource=%q,method=%q} %d\n", name, key.resource, key.method, h.count)
+	}
+	name = m.prefix + "_requests_in_flight"
+	fmt.Fprintf(&b, "# HELP %s The number of requests being handled, by resource and method.\n", name)
+	fmt.Fprintf(&b, "# TYPE %s gauge\n", name)
+	for _, key := range keys {
+		fmt.Fprintf(&b, "%s{resource=%q,method=%q} %d\n", name, key.resource, key.method, m.inFlight[key])
+	}
+	writer.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	writer.Write([]byte(b.String()))
+}
+
+// metricsWriter records the status of the response written through it.
+type metricsWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *metricsWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *metricsWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap returns the underlying writer, for http.ResponseController.
+func (w *metricsWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// listParam returns the values of an array query param in the style declared by its x_list_style
+// annotation: "csv" (a=1,2), "brackets" (a[]=1&a[]=2), or else the repeated key (a=1&a=2).
+func listParam(request *http.Request, name string, style string) []string {
+	query := request.URL.Query()
+	switch style {
+	case "csv":
+		var values []string
+		for _, v := range query[name] {
+			if v != "" {
+				values = append(values, strings.Split(v, ",")...)
+			}
+		}
+		return values
+	case "brackets":
+		return query[name+"[]"]
+	}
+	return query[name]
+}
+
+func (adaptor {{name}}Adaptor) authenticate(context *rdl.ResourceContext, resource string) bool {
 	if adaptor.authenticators != nil {
 		for _, authn := range adaptor.authenticators {
 			var creds []string
@@ -161,43 +514,307 @@ func (adaptor {{name}}Adaptor) authenticate(context *rdl.ResourceContext) bool {
 	if adaptor.impl.Authenticate(context) {
 		return true
 	}
-	log.Println("*** Authentication failed against all authenticator(s)")
+	adaptor.logger.Warn("authentication failed against all authenticator(s)", "resource", resource, "outcome", "unauthenticated")
 	return false
 }
 
-func (adaptor {{name}}Adaptor) authorize(context *rdl.ResourceContext, action string, resource string) bool {
+func (adaptor {{name}}Adaptor) authorize(context *rdl.ResourceContext, resource string, action string, target string) bool {
 	if adaptor.authorizer == nil {
 		return true
 	}
-	if !adaptor.authenticate(context) {
+	if !adaptor.authenticate(context, resource) {
 		return false
 	}
-	ok, err := adaptor.authorizer.Authorize(action, resource, context.Principal)
-	if err == nil {
-		return ok
+	ok, err := adaptor.authorizer.Authorize(action, target, context.Principal)
+	if err != nil {
+		adaptor.logger.Error("error when trying to authorize", "resource", resource, "principal", principalName(context), "outcome", "error", "action", action, "target", target, "error", err.Error())
+		return false
 	}
-	log.Println("*** Error when trying to authorize:", err)
-	return false
+	if !ok {
+		adaptor.logger.Warn("authorization denied", "resource", resource, "principal", principalName(context), "outcome", "denied", "action", action, "target", target)
+	}
+	return ok
 }
 
-func intFromString(s string) int64 {
-	var n int64 = 0
-	_, _ = fmt.Sscanf(s, "%d", &n)
-	return n
+// parseParam parses the string value of a param into target, which points to a number, a bool, a
+// timestamp, a UUID or an enum. It returns an error if the whole value is not valid for the type.
+func parseParam(s string, target interface{}) error {
+	switch t := target.(type) {
+	case *rdl.Timestamp:
+		//rdl.Timestamp quietly ignores bad values when unmarshalling JSON
+		ts, err := rdl.TimestampParse(s)
+		if err == nil {
+			*t = ts
+		}
+		return err
+	case json.Unmarshaler:
+		return t.UnmarshalJSON([]byte(strconv.Quote(s)))
+	}
+	v := reflect.ValueOf(target).Elem()
+	switch v.Kind() {
+	case reflect.Bool:
+		if s != "true" && s != "false" {
+			return fmt.Errorf("invalid bool %q", s)
+		}
+		v.SetBool(s == "true")
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(n)
+	default:
+		return fmt.Errorf("cannot parse a param of type %s", v.Type())
+	}
+	return nil
+}
+{{if validate}}
+var validation struct {
+	once     sync.Once
+	schema   *rdl.Schema
+	registry rdl.TypeRegistry
 }
 
-func floatFromString(s string) float64 {
-	var n float64 = 0
-	_, _ = fmt.Sscanf(s, "%g", &n)
-	return n
+// validationSchema returns the schema and its type registry, which are built on first use only.
+// It also enables the validator cache of the rdl library, so that rdl.Validate reuses its own
+// registry of the schema instead of building it for every input.
+func validationSchema() (*rdl.Schema, rdl.TypeRegistry) {
+	validation.once.Do(func() {
+		rdl.ValidatorUseCache(true)
+		validation.schema = {{name}}Schema()
+		validation.registry = rdl.NewTypeRegistry(validation.schema)
+	})
+	return validation.schema, validation.registry
 }
-{{range .Resources}}
+
+func validateInput(name string, typename string, data interface{}) *rdl.ResourceError {
+	schema, registry := validationSchema()
+{{if untagged}}	data = tagUnions(schema, registry, rdl.TypeRef(typename), data)
+{{end}}	v := rdl.Validate(schema, typename, data)
+	if v.Valid {
+		v.Context, v.Error = validateNumberRanges(registry, rdl.TypeRef(typename), data, typename)
+		if v.Error == "" {
+			return nil
+		}
+	}
+	field := name
+	if strings.HasPrefix(v.Context, typename+".") {
+		field += v.Context[len(typename):]
+	}
+	return &rdl.ResourceError{Code: http.StatusBadRequest, Message: "Invalid " + field + ": " + v.Error}
+}
+
+// validateNumberRanges checks the min and max constraints of number types, which rdl.Validate
+// does not enforce. It returns the context and message of the first violation found.
+func validateNumberRanges(reg rdl.TypeRegistry, typename rdl.TypeRef, data interface{}, context string) (string, string) {
+	t := reg.FindType(typename)
+	if t == nil {
+		return "", ""
+	}
+	switch t.Variant {
+	case rdl.TypeVariantAliasTypeDef:
+		return validateNumberRanges(reg, t.AliasTypeDef.Type, data, context)
+	case rdl.TypeVariantNumberTypeDef:
+		n, ok := data.(float64)
+		if !ok {
+			return "", ""
+		}
+		typedef := t.NumberTypeDef
+		if min, ok := numberValue(typedef.Min); ok && n < min {
+			return context, fmt.Sprintf("Value is less than 'min' constraint (%v)", min)
+		}
+		if max, ok := numberValue(typedef.Max); ok && n > max {
+			return context, fmt.Sprintf("Value is greater than 'max' constraint (%v)", max)
+		}
+		if typedef.Type != rdl.TypeRef(typedef.Name) {
+			return validateNumberRanges(reg, typedef.Type, data, context)
+		}
+	case rdl.TypeVariantArrayTypeDef:
+		return validateItemRanges(reg, t.ArrayTypeDef.Items, data, context)
+	case rdl.TypeVariantMapTypeDef:
+		return validateItemRanges(reg, t.MapTypeDef.Items, data, context)
+	case rdl.TypeVariantUnionTypeDef:
+		//rdl.Validate has checked that the data is wrapped in the name of its variant
+		if m, ok := data.(map[string]interface{}); ok {
+			for variant, d := range m {
+				return validateNumberRanges(reg, rdl.TypeRef(variant), d, context)
+			}
+		}
+	case rdl.TypeVariantStructTypeDef:
+		m, ok := data.(map[string]interface{})
+		if !ok {
+			return "", ""
+		}
+		for typedef := t.StructTypeDef; typedef != nil; {
+			for _, f := range typedef.Fields {
+				d, ok := m[string(f.Name)]
+				if !ok {
+					continue
+				}
+				fcontext := context + "." + string(f.Name)
+				if f.Items != "" {
+					if c, e := validateItemRanges(reg, f.Items, d, fcontext); e != "" {
+						return c, e
+					}
+				} else if c, e := validateNumberRanges(reg, f.Type, d, fcontext); e != "" {
+					return c, e
+				}
+			}
+			super := reg.FindType(typedef.Type)
+			if super == nil || super.Variant != rdl.TypeVariantStructTypeDef {
+				break
+			}
+			typedef = super.StructTypeDef
+		}
+	}
+	return "", ""
+}
+
+func validateItemRanges(reg rdl.TypeRegistry, items rdl.TypeRef, data interface{}, context string) (string, string) {
+	switch d := data.(type) {
+	case []interface{}:
+		for i, item := range d {
+			if c, e := validateNumberRanges(reg, items, item, fmt.Sprintf("%s[%d]", context, i)); e != "" {
+				return c, e
+			}
+		}
+	case map[string]interface{}:
+		for k, item := range d {
+			if c, e := validateNumberRanges(reg, items, item, context+"."+k); e != "" {
+				return c, e
+			}
+		}
+	}
+	return "", ""
+}
+
+{{with untagged}}
+// untaggedUnions are the union types that are serialized as the value of their variant alone.
+var untaggedUnions = map[rdl.TypeRef]bool{ {{.}} }
+
+// tagUnions wraps the values of untagged unions in the data with the name of their variant, the
+// first one they are valid as, which is how rdl.Validate expects all unions to be serialized.
+func tagUnions(schema *rdl.Schema, reg rdl.TypeRegistry, typename rdl.TypeRef, data interface{}) interface{} {
+	t := reg.FindType(typename)
+	if t == nil {
+		return data
+	}
+	switch t.Variant {
+	case rdl.TypeVariantAliasTypeDef:
+		return tagUnions(schema, reg, t.AliasTypeDef.Type, data)
+	case rdl.TypeVariantArrayTypeDef:
+		return tagItemUnions(schema, reg, t.ArrayTypeDef.Items, data)
+	case rdl.TypeVariantMapTypeDef:
+		return tagItemUnions(schema, reg, t.MapTypeDef.Items, data)
+	case rdl.TypeVariantUnionTypeDef:
+		if !untaggedUnions[typename] {
+			if m, ok := data.(map[string]interface{}); ok && len(m) == 1 {
+				for variant, d := range m {
+					return map[string]interface{}{variant: tagUnions(schema, reg, rdl.TypeRef(variant), d)}
+				}
+			}
+			return data
+		}
+		for _, variant := range t.UnionTypeDef.Variants {
+			d := tagUnions(schema, reg, variant, data)
+			if rdl.Validate(schema, string(variant), d).Valid {
+				return map[string]interface{}{string(variant): d}
+			}
+		}
+	case rdl.TypeVariantStructTypeDef:
+		m, ok := data.(map[string]interface{})
+		if !ok {
+			return data
+		}
+		tagged := make(map[string]interface{}, len(m))
+		for k, d := range m {
+			tagged[k] = d
+		}
+		for typedef := t.StructTypeDef; typedef != nil; {
+			for _, f := range typedef.Fields {
+				d, ok := m[string(f.Name)]
+				if !ok {
+					continue
+				}
+				if f.Items != "" {
+					tagged[string(f.Name)] = tagItemUnions(schema, reg, f.Items, d)
+				} else {
+					tagged[string(f.Name)] = tagUnions(schema, reg, f.Type, d)
+				}
+			}
+			super := reg.FindType(typedef.Type)
+			if super == nil || super.Variant != rdl.TypeVariantStructTypeDef {
+				break
+			}
+			typedef = super.StructTypeDef
+		}
+		return tagged
+	}
+	return data
+}
+
+func tagItemUnions(schema *rdl.Schema, reg rdl.TypeRegistry, items rdl.TypeRef, data interface{}) interface{} {
+	switch d := data.(type) {
+	case []interface{}:
+		tagged := make([]interface{}, len(d))
+		for i, item := range d {
+			tagged[i] = tagUnions(schema, reg, items, item)
+		}
+		return tagged
+	case map[string]interface{}:
+		tagged := make(map[string]interface{}, len(d))
+		for k, item := range d {
+			tagged[k] = tagUnions(schema, reg, items, item)
+		}
+		return tagged
+	}
+	return data
+}
+{{end}}
+func numberValue(n *rdl.Number) (float64, bool) {
+	if n == nil {
+		return 0, false
+	}
+	switch {
+	case n.Int8 != nil:
+		return float64(*n.Int8), true
+	case n.Int16 != nil:
+		return float64(*n.Int16), true
+	case n.Int32 != nil:
+		return float64(*n.Int32), true
+	case n.Int64 != nil:
+		return float64(*n.Int64), true
+	case n.Float32 != nil:
+		return float64(*n.Float32), true
+	case n.Float64 != nil:
+		return *n.Float64, true
+	}
+	return 0, false
+}
+{{end}}{{range .Resources}}
 func (adaptor {{name}}Adaptor) {{handlerSig .}} {
-	context := &rdl.ResourceContext{Writer: writer, Request: request, Params: params, Principal: nil}
 {{handlerBody .}}
 }
 {{end}}`
 
+// goUntaggedUnions returns the entries of the set of the given union types in the schema, or ""
+// if there are none.
+func goUntaggedUnions(reg rdl.TypeRegistry, names []string) string {
+	var entries []string
+	for _, name := range names {
+		if t := reg.FindType(rdl.TypeRef(name)); t != nil && t.Variant == rdl.TypeVariantUnionTypeDef {
+			entries = append(entries, fmt.Sprintf("%q: true", name))
+		}
+	}
+	return strings.Join(entries, ", ")
+}
+
 func makeTypeRef(reg rdl.TypeRegistry, t *rdl.Type, precise bool) string {
 	switch t.Variant {
 	case rdl.TypeVariantAliasTypeDef:
@@ -222,7 +839,8 @@ func makeTypeRef(reg rdl.TypeRegistry, t *rdl.Type, precise bool) string {
 		typedef := t.EnumTypeDef
 		return gomodel.GoType(reg, typedef.Type, false, "", "", precise, true)
 	case rdl.TypeVariantUnionTypeDef:
-		return "interface{}" //! FIX
+		typedef := t.UnionTypeDef
+		return gomodel.GoType(reg, rdl.TypeRef(typedef.Name), false, "", "", precise, true)
 	}
 	return "?" //never happens
 }
@@ -261,21 +879,45 @@ func (gen *serverGenerator) processTemplate(templateSource string) error {
 		"basename":    basenameFunc,
 		"comment":     commentFun,
 		"uMethod":     func(r *rdl.Resource) string { return strings.ToUpper(r.Method) },
-		"methodSig":   func(r *rdl.Resource) string { return goServerMethodSignature(gen.registry, r, gen.precise) },
+		"methodSig": func(r *rdl.Resource) string {
+			return goServerMethodSignature(gen.registry, r, gen.precise, gen.withContext, gen.reqRep)
+		},
 		"handlerName": func(r *rdl.Resource) string {
 			n, _ := goMethodName(gen.registry, r, gen.precise)
 			return uncapitalize(n) + "Handler"
 		},
 		"handlerSig": func(r *rdl.Resource) string { return goHandlerSignature(gen.registry, r, gen.precise) },
 		"handlerBody": func(r *rdl.Resource) string {
-			return goHandlerBody(gen.registry, gen.name, r, gen.precise, gen.prefixEnums)
+			return goHandlerBody(gen.registry, gen.name, r, gen.precise, gen.prefixEnums, gen.validate, gen.withContext, gen.reqRep)
+		},
+		"reqRepTypes": func(r *rdl.Resource) string { return goServerReqRepTypes(gen.registry, r, gen.precise) },
+		"exceptionConstructors": func() string {
+			return goExceptionConstructors(gen.registry, gen.schema, capitalize(gen.name), gen.precise)
+		},
+		"validate": func() bool { return gen.validate },
+		"metricsPrefix": func() string {
+			return strings.ToLower(string(gen.schema.Name))
+		},
+		"untagged":    func() string { return goUntaggedUnions(gen.registry, gen.untagged) },
+		"withContext": func() bool { return gen.withContext },
+		"reqRep":      func() bool { return gen.reqRep },
+		"client":      func() string { return gen.name + "Client" },
+		"server":      func() string { return gen.name + "Server" },
+		"name":        func() string { return gen.name },
+		"cName":       func() string { return capitalize(gen.name) },
+		"methodName":  func(r *rdl.Resource) string { n, _ := goMethodName(gen.registry, r, gen.precise); return n },
+		"methodPath":  func(r *rdl.Resource) string { return resourcePath(r) },
+		"resourceInfo": func(r *rdl.Resource) string {
+			n, _ := goMethodName(gen.registry, r, gen.precise)
+			return fmt.Sprintf("&%sResource{Name: %q, Method: %q, Path: %q}", capitalize(gen.name), capitalize(n), strings.ToUpper(r.Method), r.Path)
+		},
+		"firstMethodName": func() string {
+			if len(gen.schema.Resources) == 0 {
+				return "GetThing"
+			}
+			n, _ := goMethodName(gen.registry, gen.schema.Resources[0], gen.precise)
+			return capitalize(n)
 		},
-		"client":     func() string { return gen.name + "Client" },
-		"server":     func() string { return gen.name + "Server" },
-		"name":       func() string { return gen.name },
-		"cName":      func() string { return capitalize(gen.name) },
-		"methodName": func(r *rdl.Resource) string { n, _ := goMethodName(gen.registry, r, gen.precise); return n },
-		"methodPath": func(r *rdl.Resource) string { return resourcePath(r) },
 	}
 	t := template.Must(template.New(gen.name).Funcs(funcMap).Parse(templateSource))
 	return t.Execute(gen.writer, gen.schema)
@@ -300,93 +942,135 @@ func resourcePath(r *rdl.Resource) string {
 	return path
 }
 
-const authenticateTemplate = `	if !adaptor.authenticate(context) {
+const authenticateTemplate = `	if !adaptor.authenticate(context, %q) {
 		rdl.JSONResponse(writer, 401, rdl.ResourceError{Code: http.StatusUnauthorized, Message: "Unauthorized"})
 		return
 	}
 `
-const authorizeTemplate = `	if !adaptor.authorize(context, %q, %s) {
+const authorizeTemplate = `	if !adaptor.authorize(context, %q, %q, %s) {
 		rdl.JSONResponse(writer, 403, rdl.ResourceError{Code: http.StatusForbidden, Message: "Forbidden"})
 		return
 	}
 `
 
-func goHandlerBody(reg rdl.TypeRegistry, name string, r *rdl.Resource, precise bool, prefixEnums bool) string {
+// goInputValidation returns the code checking an input against the constraints of its type
+// in the schema, or "" if the type has none that can be checked once the input is parsed.
+func goInputValidation(reg rdl.TypeRegistry, in *rdl.ResourceInput, name string) string {
+	if reg.IsBaseTypeName(in.Type) {
+		return ""
+	}
+	value := name
+	cond := ""
+	switch reg.BaseTypeName(in.Type) {
+	case "String", "Symbol":
+		if in.PathParam {
+			value = fmt.Sprintf("context.Params[%q]", in.Name)
+		} else {
+			value = "string(" + name + ")"
+			cond = name + " != \"\""
+		}
+	case "Enum":
+		//the enum constructors quietly default bad values, so check the raw string
+		if in.PathParam {
+			value = fmt.Sprintf("context.Params[%q]", in.Name)
+		} else if in.QueryParam != "" {
+			value = name + "Optional"
+			cond = value + " != \"\""
+		} else if in.Header != "" {
+			//the header is decoded as JSON, which only accepts the symbols of the enum
+			return ""
+		} else {
+			cond = name + " != \"\""
+		}
+	case "Int8", "Int16", "Int32", "Int64", "Float32", "Float64":
+		if (in.QueryParam != "" && in.Optional && in.Default == nil) || (in.Header != "" && in.Optional) {
+			value = "float64(*" + name + ")"
+			cond = name + " != nil"
+		} else {
+			value = "float64(" + name + ")"
+		}
+	default:
+		return ""
+	}
+	tab := "\t"
+	if cond != "" {
+		tab = "\t\t"
+	}
+	s := fmt.Sprintf("%sif verr := validateInput(%q, %q, %s); verr != nil {\n", tab, in.Name, in.Type, value)
+	s += tab + "\trdl.JSONResponse(writer, http.StatusBadRequest, verr)\n"
+	s += tab + "\treturn\n"
+	s += tab + "}\n"
+	if cond != "" {
+		s = "\tif " + cond + " {\n" + s + "\t}\n"
+	}
+	return s
+}
+
+func goHandlerBody(reg rdl.TypeRegistry, name string, r *rdl.Resource, precise bool, prefixEnums bool, validate bool, withContext bool, reqRep bool) string {
 	s := ""
+	methName, _ := goMethodName(reg, r, precise)
 	var fargs []string
 	bodyName := ""
 	for _, in := range r.Inputs {
 		name := "arg" + capitalize(string(in.Name))
 		if in.QueryParam != "" {
 			qname := in.QueryParam
-			if in.Optional || in.Default != nil {
+			if reg.IsArrayTypeName(in.Type) {
+				s += goListParamInit(reg, in, name, listStyle(in), precise, validate)
+			} else if in.Optional || in.Default != nil {
 				s += goParamInit(reg, qname, name, in.Type, in.Default, in.Optional, precise, prefixEnums)
 			} else {
 				log.Printf("RDL error: queryparam '%s' must either be optional or have a default value\n", in.Name)
 			}
+			if validate {
+				s += goInputValidation(reg, in, name)
+			}
 			fargs = append(fargs, name)
 		} else if in.PathParam {
-			bt := reg.BaseTypeName(in.Type)
-			switch bt {
-			case "Enum":
-				s += fmt.Sprintf("\t%s := New%s(context.Params[%q])\n", name, in.Type, in.Name)
-			case "Int32", "Int64", "Int16", "Int8":
-				if precise {
-					s += fmt.Sprintf("\t%s := %s(intFromString(context.Params[%q]))\n", name, in.Type, in.Name)
-				} else {
-					s += fmt.Sprintf("\t%s := intFromString(context.Params[%q])\n", name, in.Name)
-				}
-			case "Float32", "Float64":
-				if precise {
-					s += fmt.Sprintf("\t%s := %s(floatFromString(context.Params[%q]))\n", name, in.Type, in.Name)
-				} else {
-					s += fmt.Sprintf("\t%s := floatFromString(context.Params[%q])\n", name, in.Name)
-				}
-			case "Timestamp":
-				s += fmt.Sprintf("\t%s, _ := rdl.%sParse(context.Params[%q])\n", name, in.Type, in.Name)
-			case "UUID":
-				s += fmt.Sprintf("\t%s := rdl.Parse%s(context.Params[%q])\n", name, in.Type, in.Name)
-			default:
-				if precise && strings.ToLower(string(in.Type)) != "string" {
-					s += fmt.Sprintf("\t%s := %s(context.Params[%q])\n", name, in.Type, in.Name)
-				} else {
-					s += fmt.Sprintf("\t%s := context.Params[%q]\n", name, in.Name)
-				}
+			s += goPathParamInit(reg, name, in, precise)
+			if validate {
+				s += goInputValidation(reg, in, name)
 			}
 			fargs = append(fargs, name)
 		} else if in.Header != "" {
-			hname := in.Header
-			def := ""
-			if in.Default != nil {
-				switch v := in.Default.(type) {
-				case string:
-					def = fmt.Sprintf("%q", v)
-				default:
-					panic(fmt.Sprintf("implement me, default value: %v", in))
-				}
-				s += "\t" + name + "Optional := " + def + "\n"
-				s += fmt.Sprintf("\t%s := rdl.HeaderParam(request, %q, %sOptional)\n", name, hname, name)
-			} else if in.Optional {
-				s += fmt.Sprintf("\t%s := rdl.OptionalHeaderParam(request, %q)\n", name, hname)
-			} else {
-				s += fmt.Sprintf("\t%s := rdl.HeaderParam(request, %q, \"\")\n", name, hname)
+			s += goHeaderParamInit(reg, in.Header, name, in.Type, in.Default, in.Optional, precise)
+			if validate {
+				s += goInputValidation(reg, in, name)
 			}
 			fargs = append(fargs, name)
 		} else {
 			bodyName = name
 			pgtype := gomodel.GoType(reg, in.Type, false, "", "", precise, true)
 			s += "\tvar " + bodyName + " " + pgtype + "\n"
-			s += "\toserr := json.NewDecoder(request.Body).Decode(&" + bodyName + ")\n"
+			if validate && !reg.IsBaseTypeName(in.Type) {
+				//decode generically first, so that the data can be checked by rdl.Validate
+				s += "\tbodyBytes, oserr := ioutil.ReadAll(request.Body)\n"
+				s += "\tvar bodyData interface{}\n"
+				s += "\tif oserr == nil {\n"
+				s += "\t\toserr = json.Unmarshal(bodyBytes, &bodyData)\n"
+				s += "\t}\n"
+				s += "\tif oserr == nil {\n"
+				s += "\t\toserr = json.Unmarshal(bodyBytes, &" + bodyName + ")\n"
+				s += "\t}\n"
+			} else {
+				s += "\toserr := json.NewDecoder(request.Body).Decode(&" + bodyName + ")\n"
+			}
 			s += "\tif oserr != nil {\n"
 			s += "\t\trdl.JSONResponse(writer, http.StatusBadRequest, rdl.ResourceError{Code: http.StatusBadRequest, Message: \"Bad request: \" + oserr.Error()})\n"
 			s += "\t\treturn\n"
 			s += "\t}\n"
+			if validate && !reg.IsBaseTypeName(in.Type) {
+				s += fmt.Sprintf("\tif verr := validateInput(%q, %q, bodyData); verr != nil {\n", in.Name, in.Type)
+				s += "\t\trdl.JSONResponse(writer, http.StatusBadRequest, verr)\n"
+				s += "\t\treturn\n"
+				s += "\t}\n"
+			}
 			fargs = append(fargs, bodyName)
 		}
 	}
 	if r.Auth != nil {
 		if r.Auth.Authenticate {
-			s += authenticateTemplate
+			s += fmt.Sprintf(authenticateTemplate, capitalize(methName))
 		} else if r.Auth.Action != "" && r.Auth.Resource != "" {
 			resource := r.Auth.Resource
 			i := strings.Index(resource, "{")
@@ -409,25 +1093,66 @@ func goHandlerBody(reg rdl.TypeRegistry, name string, r *rdl.Resource, precise b
 			if strings.HasPrefix(resource, "\"\" + ") {
 				resource = resource[5:]
 			}
-			s += fmt.Sprintf(authorizeTemplate, r.Auth.Action, resource)
+			s += fmt.Sprintf(authorizeTemplate, capitalize(methName), r.Auth.Action, resource)
 		} else {
 			log.Println("*** Badly formed auth spec in resource input:", r)
 		}
 	}
-	methName, _ := goMethodName(reg, r, precise)
 	sargs := ""
-	if len(fargs) > 0 {
+	if reqRep {
+		//pass the inputs in one struct, and unpack the output struct into the usual variables below
+		var fields []string
+		for i, in := range r.Inputs {
+			if in.Context == "" {
+				fields = append(fields, capitalize(string(in.Name))+": "+fargs[i])
+			}
+		}
+		s += "\tinput := &" + capitalize(methName) + "Input{" + strings.Join(fields, ", ") + "}\n"
+		sargs = ", input"
+	} else if len(fargs) > 0 {
 		sargs = ", " + strings.Join(fargs, ", ")
 	}
+	if withContext {
+		//the request's context is canceled when the client goes away
+		sargs = "request.Context(), context" + sargs
+	} else {
+		sargs = "context" + sargs
+	}
 	outHeaders := ""
 	for _, v := range r.Outputs {
 		outHeaders += ", " + string(v.Name)
 	}
 	noContent := r.Expected == "NO_CONTENT" && len(r.Alternatives) == 0
-	if noContent {
-		s += "\terr" + outHeaders + " := adaptor.impl." + capitalize(methName) + "(context" + sargs + ")\n"
+	if reqRep {
+		unpacked := make([]string, 0)
+		fields := make([]string, 0)
+		if !noContent {
+			unpacked = append(unpacked, "data")
+			fields = append(fields, "output.Body")
+		}
+		if len(r.Alternatives) > 0 {
+			unpacked = append(unpacked, "status")
+			fields = append(fields, "output.Status")
+		}
+		for _, v := range r.Outputs {
+			unpacked = append(unpacked, string(v.Name))
+			fields = append(fields, "output."+capitalize(string(v.Name)))
+		}
+		if len(unpacked) == 0 {
+			s += "\t_, err := adaptor.impl." + capitalize(methName) + "(" + sargs + ")\n"
+		} else {
+			s += "\toutput, err := adaptor.impl." + capitalize(methName) + "(" + sargs + ")\n"
+			s += "\tif output == nil {\n"
+			s += "\t\toutput = &" + capitalize(methName) + "Output{}\n"
+			s += "\t}\n"
+			s += "\t" + strings.Join(unpacked, ", ") + " := " + strings.Join(fields, ", ") + "\n"
+		}
+	} else if noContent {
+		s += "\terr" + outHeaders + " := adaptor.impl." + capitalize(methName) + "(" + sargs + ")\n"
+	} else if len(r.Alternatives) > 0 {
+		s += "\tdata, status" + outHeaders + ", err := adaptor.impl." + capitalize(methName) + "(" + sargs + ")\n"
 	} else {
-		s += "\tdata" + outHeaders + ", err := adaptor.impl." + capitalize(methName) + "(context" + sargs + ")\n"
+		s += "\tdata" + outHeaders + ", err := adaptor.impl." + capitalize(methName) + "(" + sargs + ")\n"
 	}
 	s += "\tif err != nil {\n"
 	s += "\t\tswitch e := err.(type) {\n"
@@ -443,10 +1168,16 @@ func goHandlerBody(reg rdl.TypeRegistry, name string, r *rdl.Resource, precise b
 	}
 
 	s += "\t\t\trdl.JSONResponse(writer, e.Code, err)\n"
+	s += "\t\tcase *" + capitalize(name) + "Exception:\n"
+	s += "\t\t\trdl.JSONResponse(writer, e.Code, e.Body)\n"
 	s += "\t\tdefault:\n"
+	s += "\t\t\tadaptor.logger.Error(\"handler failed\", \"resource\", \"" + capitalize(methName) + "\", \"principal\", principalName(context), \"outcome\", \"error\", \"error\", e.Error())\n"
 	s += "\t\t\trdl.JSONResponse(writer, 500, &rdl.ResourceError{Code: 500, Message: e.Error()})\n"
 	s += "\t\t}\n"
 	s += "\t} else {\n"
+	if len(r.Alternatives) > 0 {
+		s += goResponseStatusCheck(r)
+	}
 	for _, v := range r.Outputs {
 		vname := string(v.Name)
 		if v.Optional {
@@ -459,14 +1190,87 @@ func goHandlerBody(reg rdl.TypeRegistry, name string, r *rdl.Resource, precise b
 	}
 	if noContent { //other non-content responses?
 		s += fmt.Sprintf("\t\twriter.WriteHeader(204)\n")
+	} else if len(r.Alternatives) > 0 {
+		var empty []string
+		for _, code := range declaredStatusCodes(r) {
+			if code == "204" || code == "304" {
+				empty = append(empty, code)
+			}
+		}
+		if len(empty) > 0 {
+			s += "\t\tswitch status {\n"
+			s += "\t\tcase " + strings.Join(empty, ", ") + ":\n"
+			s += "\t\t\twriter.WriteHeader(status)\n"
+			s += "\t\tdefault:\n"
+			s += "\t\t\trdl.JSONResponse(writer, status, data)\n"
+			s += "\t\t}\n"
+		} else {
+			s += "\t\trdl.JSONResponse(writer, status, data)\n"
+		}
 	} else {
-		//fixme: handle alternative responses. How deos the handler pass them back?
 		s += fmt.Sprintf("\t\trdl.JSONResponse(writer, %s, data)\n", rdl.StatusCode(r.Expected))
 	}
 	s += "\t}\n"
 	return s
 }
 
+// goExceptionConstructors returns a constructor for each distinct status and type of the exceptions
+// declared by the resources in the schema, i.e. NewNotFoundResourceError for "ResourceError NOT_FOUND".
+func goExceptionConstructors(reg rdl.TypeRegistry, schema *rdl.Schema, cName string, precise bool) string {
+	s := ""
+	done := make(map[string]bool)
+	for _, r := range schema.Resources {
+		for _, status := range sortedExceptionCodes(r.Exceptions) {
+			etype := r.Exceptions[status].Type
+			fname := "New" + SnakeToCamel(status) + etype
+			if done[fname] {
+				continue
+			}
+			done[fname] = true
+			var gtype string
+			if reg.FindType(rdl.TypeRef(etype)) != nil {
+				gtype = gomodel.GoType(reg, rdl.TypeRef(etype), false, "", "", precise, true)
+			} else if etype == "ResourceError" {
+				gtype = "*rdl.ResourceError"
+			} else {
+				log.Printf("RDL error: unknown exception type '%s' in resource %s %s\n", etype, strings.ToUpper(r.Method), r.Path)
+				continue
+			}
+			code := rdl.StatusCode(status)
+			s += "\n//\n// " + fname + " returns the " + status + " (" + code + ") exception with the body.\n//\n"
+			s += "func " + fname + "(body " + gtype + ") *" + cName + "Exception {\n"
+			s += "\treturn &" + cName + "Exception{Code: " + code + ", Body: body}\n"
+			s += "}\n"
+		}
+	}
+	return s
+}
+
+// declaredStatusCodes returns the expected status code of the resource, followed by its alternatives.
+func declaredStatusCodes(r *rdl.Resource) []string {
+	codes := []string{rdl.StatusCode(r.Expected)}
+	for _, alt := range r.Alternatives {
+		codes = append(codes, rdl.StatusCode(alt))
+	}
+	return codes
+}
+
+// goResponseStatusCheck returns the code checking the status returned by the handler of a resource
+// with alternative responses. A zero status means the expected one, and any status that the
+// resource doesn't declare is a server error.
+func goResponseStatusCheck(r *rdl.Resource) string {
+	codes := declaredStatusCodes(r)
+	s := "\t\tswitch status {\n"
+	s += "\t\tcase 0:\n"
+	s += "\t\t\tstatus = " + codes[0] + "\n"
+	s += "\t\tcase " + strings.Join(codes, ", ") + ":\n"
+	s += "\t\tdefault:\n"
+	s += "\t\t\trdl.JSONResponse(writer, 500, &rdl.ResourceError{Code: 500, Message: fmt.Sprintf(\"Undeclared response status: %d\", status)})\n"
+	s += "\t\t\treturn\n"
+	s += "\t\t}\n"
+	return s
+}
+
 func goParamInit(reg rdl.TypeRegistry, qname string, pname string, ptype rdl.TypeRef, pdefault interface{}, poptional bool, precise bool, prefixEnums bool) string {
 	s := ""
 	gtype := gomodel.GoType(reg, ptype, false, "", "", precise, true)
@@ -609,18 +1413,175 @@ func goParamInit(reg rdl.TypeRegistry, qname string, pname string, ptype rdl.Typ
 	return s
 }
 
+// arrayItems returns the type of the items of the array type, or "" if it doesn't declare one.
+func arrayItems(reg rdl.TypeRegistry, typename rdl.TypeRef) rdl.TypeRef {
+	t := reg.FindType(typename)
+	for t != nil && t.Variant != rdl.TypeVariantArrayTypeDef {
+		if t.Variant == rdl.TypeVariantBaseType {
+			return ""
+		}
+		_, super, _ := rdl.TypeInfo(t)
+		t = reg.FindType(super)
+	}
+	if t == nil {
+		return ""
+	}
+	return t.ArrayTypeDef.Items
+}
+
+// goHeaderParamInit returns the code initializing the variable pname with the value of the header
+// hname, or its default when it is absent. Values that are not strings are parsed like path params,
+// and a bad value is rejected with a 400.
+func goHeaderParamInit(reg rdl.TypeRegistry, hname string, pname string, ptype rdl.TypeRef, pdefault interface{}, poptional bool, precise bool) string {
+	gtype := gomodel.GoType(reg, ptype, false, "", "", precise, true)
+	s := ""
+	switch reg.BaseTypeName(ptype) {
+	case "Bool", "Int8", "Int16", "Int32", "Int64", "Float32", "Float64", "Enum", "Timestamp", "UUID":
+		if poptional {
+			s += "\tvar " + pname + " *" + gtype + "\n"
+		} else {
+			s += "\tvar " + pname + " " + gtype + "\n"
+		}
+		if pdefault != nil {
+			s += fmt.Sprintf("\tif v := rdl.HeaderParam(request, %q, %q); v != \"\" {\n", hname, goParamDefault(reg, ptype, pdefault))
+		} else {
+			s += fmt.Sprintf("\tif v := rdl.OptionalHeaderParam(request, %q); v != \"\" {\n", hname)
+		}
+		s += goParseItem(gtype, "\t\t")
+		s += "\t\tif err != nil {\n"
+		s += fmt.Sprintf("\t\t\trdl.JSONResponse(writer, 400, rdl.ResourceError{Code: 400, Message: \"Invalid value for header %s: \" + v})\n", hname)
+		s += "\t\t\treturn\n"
+		s += "\t\t}\n"
+		if poptional {
+			s += "\t\t" + pname + " = &item\n"
+		} else {
+			s += "\t\t" + pname + " = item\n"
+		}
+		s += "\t}\n"
+	default:
+		value := ""
+		if pdefault != nil {
+			value = fmt.Sprintf("rdl.HeaderParam(request, %q, %q)", hname, goParamDefault(reg, ptype, pdefault))
+		} else if poptional {
+			value = fmt.Sprintf("rdl.OptionalHeaderParam(request, %q)", hname)
+		} else {
+			value = fmt.Sprintf("rdl.HeaderParam(request, %q, \"\")", hname)
+		}
+		if gtype != "string" {
+			value = gtype + "(" + value + ")"
+		}
+		s += "\t" + pname + " := " + value + "\n"
+	}
+	return s
+}
+
+// goParamDefault returns the default value of a param as the string that parseParam parses back
+// into it. The defaults of integer params are float64 in the schema, and fmt.Sprint would format
+// the large ones with an exponent.
+func goParamDefault(reg rdl.TypeRegistry, ptype rdl.TypeRef, pdefault interface{}) string {
+	v, ok := pdefault.(float64)
+	if !ok {
+		return fmt.Sprint(pdefault)
+	}
+	switch reg.BaseTypeName(ptype) {
+	case "Int8", "Int16", "Int32", "Int64":
+		return strconv.FormatInt(int64(v), 10)
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// goParseItem returns the code parsing the string v as the item type into item, setting err if it is
+// not valid.
+func goParseItem(itype string, tab string) string {
+	return tab + "var item " + itype + "\n" + tab + "err := parseParam(v, &item)\n"
+}
+
+// goPathParamInit returns the code initializing the variable pname with the value of the path param,
+// responding with a 400 if it cannot be parsed as its type.
+func goPathParamInit(reg rdl.TypeRegistry, pname string, in *rdl.ResourceInput, precise bool) string {
+	value := fmt.Sprintf("context.Params[%q]", in.Name)
+	switch reg.BaseTypeName(in.Type) {
+	case "Bool", "Int8", "Int16", "Int32", "Int64", "Float32", "Float64", "Enum", "Timestamp", "UUID":
+		gtype := gomodel.GoType(reg, in.Type, false, "", "", precise, true)
+		s := "\tvar " + pname + " " + gtype + "\n"
+		s += "\tif err := parseParam(" + value + ", &" + pname + "); err != nil {\n"
+		s += fmt.Sprintf("\t\trdl.JSONResponse(writer, http.StatusBadRequest, rdl.ResourceError{Code: http.StatusBadRequest, Message: \"Path parameter '%s' is not a valid %s: \" + %s})\n", in.Name, in.Type, value)
+		s += "\t\treturn\n"
+		s += "\t}\n"
+		return s
+	}
+	if precise && strings.ToLower(string(in.Type)) != "string" {
+		return fmt.Sprintf("\t%s := %s(%s)\n", pname, in.Type, value)
+	}
+	return fmt.Sprintf("\t%s := %s\n", pname, value)
+}
+
+// goListParamInit returns the code that parses the values of an array query param into its items.
+// If validate is set, each item is also validated against its type.
+func goListParamInit(reg rdl.TypeRegistry, in *rdl.ResourceInput, pname string, style string, precise bool, validate bool) string {
+	qname := in.QueryParam
+	gtype := gomodel.GoType(reg, in.Type, false, "", "", precise, true)
+	items := arrayItems(reg, in.Type)
+	if items == "" {
+		log.Printf("RDL error: cannot find the items of the array queryparam %q\n", qname)
+		return ""
+	}
+	itype := gomodel.GoType(reg, items, false, "", "", precise, true)
+	s := "\tvar " + pname + " " + gtype + "\n"
+	s += fmt.Sprintf("\tfor _, v := range listParam(request, %q, %q) {\n", qname, style)
+	value := ""
+	switch reg.BaseTypeName(items) {
+	case "String", "Symbol":
+		item := "v"
+		if itype != "string" {
+			item = itype + "(v)"
+		}
+		s += "\t\t" + pname + " = append(" + pname + ", " + item + ")\n"
+		value = "v"
+	case "Bool", "Int8", "Int16", "Int32", "Int64", "Float32", "Float64", "Enum", "Timestamp", "UUID":
+		s += goParseItem(itype, "\t\t")
+		s += "\t\tif err != nil {\n"
+		s += fmt.Sprintf("\t\t\trdl.JSONResponse(writer, 400, rdl.ResourceError{Code: 400, Message: \"Invalid value for %s: \" + v})\n", qname)
+		s += "\t\t\treturn\n"
+		s += "\t\t}\n"
+		s += "\t\t" + pname + " = append(" + pname + ", item)\n"
+		switch reg.BaseTypeName(items) {
+		case "Enum":
+			value = "v"
+		case "Int8", "Int16", "Int32", "Int64", "Float32", "Float64":
+			value = "float64(item)"
+		}
+	default:
+		log.Printf("RDL error: the items of the array queryparam %q cannot be of type %s\n", qname, items)
+	}
+	if validate && value != "" && !reg.IsBaseTypeName(items) {
+		s += fmt.Sprintf("\t\tif verr := validateInput(%q, %q, %s); verr != nil {\n", in.Name, items, value)
+		s += "\t\t\trdl.JSONResponse(writer, http.StatusBadRequest, verr)\n"
+		s += "\t\t\treturn\n"
+		s += "\t\t}\n"
+	}
+	s += "\t}\n"
+	return s
+}
+
 func goHandlerSignature(reg rdl.TypeRegistry, r *rdl.Resource, precise bool) string {
 	methName, _ := goMethodName(reg, r, precise)
-	args := "writer http.ResponseWriter, request *http.Request, params map[string]string"
+	args := "context *rdl.ResourceContext, writer http.ResponseWriter, request *http.Request"
 	return methName + "Handler(" + args + ")"
 }
 
-func goServerMethodSignature(reg rdl.TypeRegistry, r *rdl.Resource, precise bool) string {
+func goServerMethodSignature(reg rdl.TypeRegistry, r *rdl.Resource, precise bool, withContext bool, reqRep bool) string {
 	noContent := r.Expected == "NO_CONTENT" && r.Alternatives == nil
 	returnSpec := "error"
-	if !noContent {
+	if reqRep {
+		methName, _ := goMethodName(reg, r, precise)
+		returnSpec = "(*" + capitalize(methName) + "Output, error)"
+	} else if !noContent {
 		gtype := gomodel.GoType(reg, r.Type, false, "", "", precise, true)
 		outHeaders := ""
+		if len(r.Alternatives) > 0 {
+			outHeaders = ", int"
+		}
 		for _, v := range r.Outputs {
 			outHeaders += ", " + gomodel.GoType(reg, v.Type, false, "", "", precise, true)
 		}
@@ -628,12 +1589,56 @@ func goServerMethodSignature(reg rdl.TypeRegistry, r *rdl.Resource, precise bool
 	}
 	methName, params := goMethodName(reg, r, precise)
 	sparams := ""
-	if len(params) > 0 {
+	if reqRep {
+		sparams = ", input *" + capitalize(methName) + "Input"
+	} else if len(params) > 0 {
 		sparams = ", " + strings.Join(params, ", ")
 	}
+	if withContext {
+		return capitalize(methName) + "(ctx context.Context, context *rdl.ResourceContext" + sparams + ") " + returnSpec
+	}
 	return capitalize(methName) + "(context *rdl.ResourceContext" + sparams + ") " + returnSpec
 }
 
+// reqRepInputs returns the inputs of the resource that are passed to the handler method.
+func reqRepInputs(r *rdl.Resource) []*rdl.ResourceInput {
+	var inputs []*rdl.ResourceInput
+	for _, in := range r.Inputs {
+		if in.Context == "" { //legacy field, to be removed
+			inputs = append(inputs, in)
+		}
+	}
+	return inputs
+}
+
+// goServerReqRepTypes returns the input and output structs of the handler method for the
+// resource. They are named XxxInput and XxxOutput, so they don't collide with the XxxRequest
+// and XxxResponse structs of the request/response client when both are in the same package.
+func goServerReqRepTypes(reg rdl.TypeRegistry, r *rdl.Resource, precise bool) string {
+	methName, _ := goMethodName(reg, r, precise)
+	methName = capitalize(methName)
+	s := "\n//\n// " + methName + "Input holds the inputs of the " + methName + " resource.\n//\n"
+	s += "type " + methName + "Input struct {\n"
+	for _, in := range reqRepInputs(r) {
+		s += "\t" + capitalize(string(in.Name)) + " " + gomodel.GoType(reg, in.Type, in.Optional, "", "", precise, true) + "\n"
+	}
+	s += "}\n"
+	s += "\n//\n// " + methName + "Output holds the response body and output headers of the " + methName + " resource.\n//\n"
+	s += "type " + methName + "Output struct {\n"
+	noContent := r.Expected == "NO_CONTENT" && r.Alternatives == nil
+	if !noContent {
+		s += "\tBody " + gomodel.GoType(reg, r.Type, false, "", "", precise, true) + "\n"
+	}
+	if len(r.Alternatives) > 0 {
+		s += "\tStatus int // one of " + strings.Join(declaredStatusCodes(r), ", ") + ", or 0 for " + rdl.StatusCode(r.Expected) + "\n"
+	}
+	for _, v := range r.Outputs {
+		s += "\t" + capitalize(string(v.Name)) + " " + gomodel.GoType(reg, v.Type, false, "", "", precise, true) + "\n"
+	}
+	s += "}\n"
+	return s
+}
+
 func goMethodName(reg rdl.TypeRegistry, r *rdl.Resource, precise bool) (string, []string) {
 	return goMethodName2(reg, r, precise, "")
 }
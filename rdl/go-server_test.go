@@ -0,0 +1,28 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ardielle/ardielle-go/rdl"
+)
+
+func TestGoHeaderParamInitLargeDefault(t *testing.T) {
+	reg := rdl.NewTypeRegistry(rdl.NewSchemaBuilder("test").Build())
+	tests := []struct {
+		ptype    rdl.TypeRef
+		pdefault interface{}
+		want     string
+	}{
+		{"Int32", float64(1000000), `"1000000"`},
+		{"Int64", float64(123456789012), `"123456789012"`},
+		{"Float64", float64(2500000.5), `"2.5000005e+06"`},
+		{"Bool", true, `"true"`},
+	}
+	for _, test := range tests {
+		code := goHeaderParamInit(reg, "X-Limit", "argLimit", test.ptype, test.pdefault, false, false)
+		if !strings.Contains(code, `rdl.HeaderParam(request, "X-Limit", `+test.want+`)`) {
+			t.Errorf("the default %v of a %s header is not rendered as %s:\n%s", test.pdefault, test.ptype, test.want, code)
+		}
+	}
+}
@@ -19,6 +19,19 @@ import (
 const HttpTreeMuxGoImport = "github.com/dimfeld/httptreemux"
 const RdlGoImport = "github.com/ardielle/ardielle-go/rdl"
 
+// the module requirements of the go.mod generated for a project
+const ArdielleGoModule = "github.com/ardielle/ardielle-go"
+const ArdielleGoVersion = "v1.5.1"
+const HttpTreeMuxGoVersion = "v5.0.1+incompatible"
+const GoModGoVersion = "1.21"
+
+// the go.sum hashes of the required versions above, so that the project builds without fetching
+// the modules first. They must be updated along with the versions.
+const ArdielleGoSum = "h1:7vSvfYuByBHGSk+8am0u2DT92+95UFtxdp5fkSEQTII="
+const ArdielleGoModSum = "h1:I4hy1n795cUhaVt/ojz83SNVCYIGsAFAONtv2Dr7HUI="
+const HttpTreeMuxGoSum = "h1:Qj3gVcDNoOthBAqftuD596rm4wg/adLLz5xh5CmpiCA="
+const HttpTreeMuxGoModSum = "h1:rbUlSV+CCpv/SuqUTP/8Bk2O3LyUV436/yaRGkhP6Z0="
+
 func SnakeToCamel(name string) string {
 	// "THIS_IS_IT" -> "ThisIsIt"
 	result := make([]rune, 0)
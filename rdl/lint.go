@@ -0,0 +1,363 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"unicode"
+
+	"github.com/ardielle/ardielle-go/rdl"
+)
+
+// lint severity levels, as used in the config file and in the SARIF output
+const (
+	lintOff     = "off"
+	lintWarning = "warning"
+	lintError   = "error"
+)
+
+// lintFinding is a single problem reported by a lint rule.
+type lintFinding struct {
+	Rule    string
+	Level   string
+	Context string
+	Message string
+}
+
+type lintRule struct {
+	id          string
+	description string
+	level       string
+	check       func(l *linter)
+}
+
+// lintConfig is read from the file given with -c. Each entry in Rules maps a rule id to
+// "off", "warning" or "error", overriding the rule's default level.
+type lintConfig struct {
+	Rules map[string]string `json:"rules"`
+}
+
+type linter struct {
+	schema   *rdl.Schema
+	registry rdl.TypeRegistry
+	rule     *lintRule
+	findings []*lintFinding
+}
+
+var lintRules = []*lintRule{
+	{"query-param-default", "query params must be optional or have a default value", lintError, lintQueryParamDefaults},
+	{"resource-comment", "resources should have a comment", lintWarning, lintResourceComments},
+	{"auth-resource-input", "auth resource templates must only reference inputs of the resource", lintError, lintAuthResourceInputs},
+	{"unused-type", "types should be referenced by a resource or another type", lintWarning, lintUnusedTypes},
+	{"casing", "types are UpperCamelCase, fields and inputs lowerCamelCase, enum symbols UPPER_CASE, resource names consistently camelCase", lintWarning, lintCasing},
+	{"duplicate-method", "resources must not map to the same generated method name", lintError, lintDuplicateMethods},
+}
+
+func (l *linter) report(context string, format string, args ...interface{}) {
+	l.findings = append(l.findings, &lintFinding{
+		Rule:    l.rule.id,
+		Level:   l.rule.level,
+		Context: context,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+func readLintConfig(path string) (*lintConfig, error) {
+	config := &lintConfig{}
+	if path == "" {
+		return config, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(data, config)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot parse lint config %q: %v", path, err)
+	}
+	for id, level := range config.Rules {
+		if findLintRule(id) == nil {
+			return nil, fmt.Errorf("Unknown lint rule in %q: %s", path, id)
+		}
+		switch level {
+		case lintOff, lintWarning, lintError:
+		default:
+			return nil, fmt.Errorf("Bad level for lint rule %s in %q: %q", id, path, level)
+		}
+	}
+	return config, nil
+}
+
+func findLintRule(id string) *lintRule {
+	for _, rule := range lintRules {
+		if rule.id == id {
+			return rule
+		}
+	}
+	return nil
+}
+
+// LintSchema runs all enabled rules against the schema and returns their findings.
+func LintSchema(schema *rdl.Schema, config *lintConfig) []*lintFinding {
+	l := &linter{
+		schema:   schema,
+		registry: rdl.NewTypeRegistry(schema),
+		findings: make([]*lintFinding, 0),
+	}
+	for _, rule := range lintRules {
+		r := *rule
+		if level, ok := config.Rules[rule.id]; ok {
+			r.level = level
+		}
+		if r.level == lintOff {
+			continue
+		}
+		l.rule = &r
+		r.check(l)
+	}
+	return l.findings
+}
+
+func lintQueryParamDefaults(l *linter) {
+	for _, r := range l.schema.Resources {
+		for _, in := range r.Inputs {
+			if in.QueryParam != "" && !in.Optional && in.Default == nil {
+				l.report(resourceContext(r), "query param '%s' must either be optional or have a default value", in.Name)
+			}
+		}
+	}
+}
+
+func lintResourceComments(l *linter) {
+	for _, r := range l.schema.Resources {
+		if strings.TrimSpace(r.Comment) == "" {
+			l.report(resourceContext(r), "resource has no comment")
+		}
+	}
+}
+
+func lintAuthResourceInputs(l *linter) {
+	for _, r := range l.schema.Resources {
+		if r.Auth == nil || r.Auth.Resource == "" {
+			continue
+		}
+		resource := r.Auth.Resource
+		i := strings.Index(resource, "{")
+		for i >= 0 {
+			j := strings.Index(resource[i:], "}")
+			if j < 0 {
+				l.report(resourceContext(r), "unterminated variable in auth resource %q", r.Auth.Resource)
+				break
+			}
+			j += i
+			name := resource[i+1 : j]
+			found := false
+			for _, in := range r.Inputs {
+				if string(in.Name) == name {
+					found = true
+					break
+				}
+			}
+			if !found {
+				l.report(resourceContext(r), "auth resource %q references unknown input '%s'", r.Auth.Resource, name)
+			}
+			resource = resource[j+1:]
+			i = strings.Index(resource, "{")
+		}
+	}
+}
+
+func lintUnusedTypes(l *linter) {
+	if len(l.schema.Resources) == 0 {
+		return //a types-only schema is meant to be used by other schemas
+	}
+	used := make(map[rdl.TypeRef]bool)
+	var use func(ref rdl.TypeRef)
+	use = func(ref rdl.TypeRef) {
+		if ref == "" || used[ref] {
+			return
+		}
+		used[ref] = true
+		t := l.registry.FindType(ref)
+		if t == nil {
+			return
+		}
+		_, super, _ := rdl.TypeInfo(t)
+		use(super)
+		switch t.Variant {
+		case rdl.TypeVariantStructTypeDef:
+			for _, f := range t.StructTypeDef.Fields {
+				use(f.Type)
+				use(f.Items)
+				use(f.Keys)
+			}
+		case rdl.TypeVariantArrayTypeDef:
+			use(t.ArrayTypeDef.Items)
+		case rdl.TypeVariantMapTypeDef:
+			use(t.MapTypeDef.Keys)
+			use(t.MapTypeDef.Items)
+		case rdl.TypeVariantUnionTypeDef:
+			for _, v := range t.UnionTypeDef.Variants {
+				use(v)
+			}
+		}
+	}
+	for _, r := range l.schema.Resources {
+		use(r.Type)
+		for _, in := range r.Inputs {
+			use(in.Type)
+		}
+		for _, out := range r.Outputs {
+			use(out.Type)
+		}
+		for _, e := range r.Exceptions {
+			use(rdl.TypeRef(e.Type))
+		}
+	}
+	for _, t := range l.schema.Types {
+		name, _, _ := rdl.TypeInfo(t)
+		if !used[rdl.TypeRef(name)] {
+			l.report("type "+string(name), "type is not used by any resource")
+		}
+	}
+}
+
+func isUpperCamel(s string) bool {
+	return s != "" && unicode.IsUpper(rune(s[0])) && !strings.Contains(s, "_")
+}
+
+func isLowerCamel(s string) bool {
+	return s != "" && unicode.IsLower(rune(s[0])) && !strings.Contains(s, "_")
+}
+
+func isUpperSnake(s string) bool {
+	return s != "" && strings.ToUpper(s) == s
+}
+
+func lintCasing(l *linter) {
+	for _, t := range l.schema.Types {
+		name, _, _ := rdl.TypeInfo(t)
+		context := "type " + string(name)
+		if !isUpperCamel(string(name)) {
+			l.report(context, "type name '%s' is not UpperCamelCase", name)
+		}
+		switch t.Variant {
+		case rdl.TypeVariantStructTypeDef:
+			for _, f := range t.StructTypeDef.Fields {
+				if !isLowerCamel(string(f.Name)) {
+					l.report(context+"."+string(f.Name), "field name '%s' is not lowerCamelCase", f.Name)
+				}
+			}
+		case rdl.TypeVariantEnumTypeDef:
+			for _, e := range t.EnumTypeDef.Elements {
+				if !isUpperSnake(string(e.Symbol)) {
+					l.report(context, "enum symbol '%s' is not UPPER_CASE", e.Symbol)
+				}
+			}
+		}
+	}
+	//resource names may be lowerCamelCase or UpperCamelCase, as long as the schema sticks to one
+	var first *rdl.Resource
+	for _, r := range l.schema.Resources {
+		name := string(r.Name)
+		if name == "" {
+			continue
+		}
+		if !isLowerCamel(name) && !isUpperCamel(name) {
+			l.report(resourceContext(r), "resource name '%s' is not camelCase", r.Name)
+		} else if first == nil {
+			first = r
+		} else if isUpperCamel(name) != isUpperCamel(string(first.Name)) {
+			l.report(resourceContext(r), "resource name '%s' is not cased like '%s' of the %s", r.Name, first.Name, resourceContext(first))
+		}
+	}
+	for _, r := range l.schema.Resources {
+		for _, in := range r.Inputs {
+			if !isLowerCamel(string(in.Name)) {
+				l.report(resourceContext(r)+" input "+string(in.Name), "input name '%s' is not lowerCamelCase", in.Name)
+			}
+		}
+		for _, out := range r.Outputs {
+			if !isLowerCamel(string(out.Name)) {
+				l.report(resourceContext(r)+" output "+string(out.Name), "output name '%s' is not lowerCamelCase", out.Name)
+			}
+		}
+	}
+}
+
+func lintDuplicateMethods(l *linter) {
+	seen := make(map[string]*rdl.Resource)
+	for _, r := range l.schema.Resources {
+		n, _ := goMethodName(l.registry, r, false)
+		n = capitalize(n)
+		if prev, ok := seen[n]; ok {
+			l.report(resourceContext(r), "generated method name %s collides with resource %s %s", n, strings.ToUpper(prev.Method), prev.Path)
+		} else {
+			seen[n] = r
+		}
+	}
+}
+
+func writeLintReport(out io.Writer, findings []*lintFinding, schemaFile string, format string) error {
+	switch format {
+	case "text":
+		for _, f := range findings {
+			fmt.Fprintf(out, "%s: %s: %s: %s [%s]\n", schemaFile, f.Level, f.Context, f.Message, f.Rule)
+		}
+		return nil
+	case "sarif":
+		j, err := json.MarshalIndent(sarifReport(findings, schemaFile), "", "    ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(out, string(j))
+		return err
+	default:
+		return fmt.Errorf("Unknown lint output format: %q", format)
+	}
+}
+
+func sarifReport(findings []*lintFinding, schemaFile string) map[string]interface{} {
+	rules := make([]interface{}, 0, len(lintRules))
+	for _, rule := range lintRules {
+		rules = append(rules, map[string]interface{}{
+			"id":               rule.id,
+			"shortDescription": map[string]string{"text": rule.description},
+		})
+	}
+	results := make([]interface{}, 0, len(findings))
+	for _, f := range findings {
+		results = append(results, map[string]interface{}{
+			"ruleId":  f.Rule,
+			"level":   f.Level,
+			"message": map[string]string{"text": f.Message},
+			"locations": []interface{}{
+				map[string]interface{}{
+					"physicalLocation": map[string]interface{}{
+						"artifactLocation": map[string]string{"uri": schemaFile},
+					},
+					"logicalLocations": []interface{}{
+						map[string]string{"fullyQualifiedName": f.Context},
+					},
+				},
+			},
+		})
+	}
+	return map[string]interface{}{
+		"version": "2.1.0",
+		"$schema": "https://json.schemastore.org/sarif-2.1.0.json",
+		"runs": []interface{}{
+			map[string]interface{}{
+				"tool": map[string]interface{}{
+					"driver": map[string]interface{}{
+						"name":  "rdl lint",
+						"rules": rules,
+					},
+				},
+				"results": results,
+			},
+		},
+	}
+}
@@ -39,6 +39,8 @@ Commands:
   validate <datafile.json> <schemafile.rdl> [<typename>]
   generate [-elt] [-o <outfile>] <generator> <schema.rdl>
   import [-o <outfile>] external_type external_file
+  diff [-j] <old.rdl> <new.rdl>
+  lint [-c <config.json>] [-f text|sarif] <schema.rdl>
 
 Generator Options:
   -o path         Use the directory or file as output for generation. Default is stdout.
@@ -49,6 +51,26 @@ Generator Options:
   -l package      Generate code that imports this package as 'rdl' for base type impl (instead of standard rdl library)
   -u type         Generate the specified union type to JSON serialize as an untagged union. Default is a tagged.
   -x key=value    Set options for external generator, e.g. -x e=true -xfoo=bar will send -e true --foo bar to external generator.
+  --validate      Generate a Go server that validates every input against the schema, responding 400 on failure (default is false)
+  --with-context  Generate Go server handler methods that take the request's context.Context as first argument (default is false)
+  --with-request-response
+                  Generate Go client and server methods that take one request struct and return one response struct (default is false)
+  --in-memory     Generate a go-server-project implementation that keeps the resources in memory instead of stubs (default is false)
+  --module path   Use this module path in the go.mod generated by go-server-project. Default is the path of an existing go.mod,
+                  else the namespace, or else the schema name. It is an error if it differs from the path of an existing go.mod.
+  --go-mod-tidy   Run 'go mod tidy' after writing a new go.mod and go.sum with go-server-project. This needs network
+                  access to fetch the modules (default is false)
+  --update-impl   Update an existing go-server-project implementation: add stubs for new resources, and report the methods
+                  whose signatures no longer match the schema (default is false)
+  --rewrite-signatures
+                  Like --update-impl, and also rewrite the mismatched signatures, keeping the method bodies (default is false)
+
+Diff Options:
+  -j              Write the report as JSON instead of text. The exit status is 2 if any change is breaking.
+
+Lint Options:
+  -c path         Read rule levels from this JSON file, e.g. {"rules": {"resource-comment": "off", "unused-type": "error"}}
+  -f format       Output format, either "text" (default) or "sarif". The exit status is 1 if any finding is an error.
 
 Generators (accepted arguments to the generate command):
   json               Generate the JSON representation of the schema
@@ -69,7 +91,7 @@ Generators (accepted arguments to the generate command):
                      is written to its stdin.
 
 `
-	fmt.Fprintf(os.Stderr, msg)
+	fmt.Fprint(os.Stderr, msg)
 	os.Exit(0)
 }
 
@@ -133,6 +155,29 @@ func main() {
 		}
 	})
 
+	app.Command("diff", "compare two schemas and report the differences, flagging breaking changes", func(cmd *cli.Cmd) {
+		asJSON := cmd.BoolOpt("j json", false, "write the report as JSON")
+		oldFile := cmd.StringArg("OLD", "", "the rdl (or json) file defining the old schema")
+		newFile := cmd.StringArg("NEW", "", "the rdl (or json) file defining the new schema")
+		cmd.Spec = "[-j] OLD NEW"
+		cmd.Action = func() {
+			oldSchema, _ := parse(*oldFile, *pretty, *warning, *strict)
+			newSchema, _ := parse(*newFile, *pretty, *warning, *strict)
+			diff(oldSchema, newSchema, *oldFile, *newFile, *asJSON)
+		}
+	})
+
+	app.Command("lint", "check the schema for style and correctness problems", func(cmd *cli.Cmd) {
+		configFile := cmd.StringOpt("c config", "", "JSON file with the rule levels to use")
+		format := cmd.StringOpt("f format", "text", "output format, text or sarif")
+		schemaFile := cmd.StringArg("FILE", "", "the rdl file defining the schema")
+		cmd.Spec = "[-c] [-f] FILE"
+		cmd.Action = func() {
+			schema, _ := parse(*schemaFile, *pretty, *warning, *strict)
+			lint(schema, *schemaFile, *configFile, *format)
+		}
+	})
+
 	app.Command("generate", "generate output from the schema, using the specified generator", func(cmd *cli.Cmd) {
 		outfile := cmd.StringOpt("o", "", "Output file or directory for generated file(s). Default is stdout")
 		preciseTypes := cmd.BoolOpt("t", false, "preserve string and scalar subtypes, if the language supports it")
@@ -143,6 +188,13 @@ func main() {
 		basePath := cmd.StringOpt("b", "", "Specify the base path of the URL for java server and client generators (default = schema name, snake-cased)")
 		externalOptions := cmd.StringsOpt("x", []string{}, "Set options for external generator, e.g. -x e=true -xfoo=bar will send -e true --foo bar to external generator")
 		requestResponse := cmd.BoolOpt("with-request-response", false, "Enable request/response objects")
+		validateInputs := cmd.BoolOpt("validate", false, "Generate server code that validates every input against the schema")
+		withContext := cmd.BoolOpt("with-context", false, "Generate server handler methods that take a context.Context")
+		inMemory := cmd.BoolOpt("in-memory", false, "Generate a working in-memory implementation in the server project")
+		updateImpl := cmd.BoolOpt("update-impl", false, "Add stubs for new resources to an existing server project implementation")
+		rewriteSignatures := cmd.BoolOpt("rewrite-signatures", false, "Like --update-impl, and also rewrite the signatures of outdated methods")
+		modulePath := cmd.StringOpt("module", "", "Module path for the go.mod of the server project (default = existing go.mod, namespace, or schema name)")
+		goModTidy := cmd.BoolOpt("go-mod-tidy", false, "Run 'go mod tidy' after writing the go.mod of the server project")
 		generator := cmd.StringArg("GENERATOR", "", "the generator to use")
 		schemaFile := cmd.StringArg("FILE", "", "the rdl file defining the schema")
 		cmd.Action = func() {
@@ -151,17 +203,24 @@ func main() {
 				schema.Name = name
 			}
 			opts := &generateOptions{
-				schema:          schema,
-				banner:          banner,
-				dirName:         *outfile,
-				librdl:          *librdl,
-				requestResponse: *requestResponse,
-				prefixEnums:     *prefixEnums,
-				preciseTypes:    *preciseTypes,
-				ns:              *ns,
-				untaggedUnions:  *untaggedUnions,
-				base:            *basePath,
-				externalOptions: *externalOptions,
+				schema:            schema,
+				banner:            banner,
+				dirName:           *outfile,
+				librdl:            *librdl,
+				requestResponse:   *requestResponse,
+				validate:          *validateInputs,
+				withContext:       *withContext,
+				inMemory:          *inMemory,
+				updateImpl:        *updateImpl,
+				rewriteSignatures: *rewriteSignatures,
+				modulePath:        *modulePath,
+				goModTidy:         *goModTidy,
+				prefixEnums:       *prefixEnums,
+				preciseTypes:      *preciseTypes,
+				ns:                *ns,
+				untaggedUnions:    *untaggedUnions,
+				base:              *basePath,
+				externalOptions:   *externalOptions,
 			}
 			generate(*generator, *schemaFile, opts)
 		}
@@ -234,6 +293,33 @@ func validate(schema *rdl.Schema, filename string, typename string, pretty bool)
 	exitOnError(err)
 }
 
+func diff(oldSchema *rdl.Schema, newSchema *rdl.Schema, oldFile string, newFile string, asJSON bool) {
+	report := &diffReport{Old: oldFile, New: newFile, Changes: DiffSchemas(oldSchema, newSchema)}
+	for _, c := range report.Changes {
+		if c.Breaking {
+			report.Breaking++
+		}
+	}
+	err := writeDiffReport(os.Stdout, report, asJSON)
+	exitOnError(err)
+	if report.Breaking > 0 {
+		os.Exit(2)
+	}
+}
+
+func lint(schema *rdl.Schema, schemaFile string, configFile string, format string) {
+	config, err := readLintConfig(configFile)
+	exitOnError(err)
+	findings := LintSchema(schema, config)
+	err = writeLintReport(os.Stdout, findings, schemaFile, format)
+	exitOnError(err)
+	for _, f := range findings {
+		if f.Level == lintError {
+			os.Exit(1)
+		}
+	}
+}
+
 func readData(schema *rdl.Schema, filename string, typename string) (interface{}, error) {
 	bytes, err := ioutil.ReadFile(filename)
 	if err == nil {
@@ -257,18 +343,25 @@ func ensureExtension(name string, ext string) string {
 }
 
 type generateOptions struct {
-	schemaFile      string
-	banner          string
-	requestResponse bool
-	dirName         string
-	librdl          string
-	prefixEnums     bool
-	preciseTypes    bool
-	ns              string
-	schema          *rdl.Schema
-	untaggedUnions  []string
-	base            string
-	externalOptions []string
+	schemaFile        string
+	banner            string
+	requestResponse   bool
+	validate          bool
+	withContext       bool
+	inMemory          bool
+	updateImpl        bool
+	rewriteSignatures bool
+	modulePath        string
+	goModTidy         bool
+	dirName           string
+	librdl            string
+	prefixEnums       bool
+	preciseTypes      bool
+	ns                string
+	schema            *rdl.Schema
+	untaggedUnions    []string
+	base              string
+	externalOptions   []string
 }
 
 func generate(flavor string, srcFile string, opts *generateOptions) {